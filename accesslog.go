@@ -0,0 +1,62 @@
+package main
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// combinedTimeLayout is the timestamp layout of the combined log format
+const combinedTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// openAccessLog opens the sink for combined access log lines, stdout unless
+// a file is configured
+func openAccessLog(cfg *Config) (zapcore.WriteSyncer, func(), error) {
+	sink := "stdout"
+	if cfg.AccessLogFile != "" {
+		var err error
+		if sink, err = logFileURL(cfg.AccessLogFile, cfg); err != nil {
+			return nil, nil, err
+		}
+	}
+	return zap.Open(sink)
+}
+
+// combinedLogLine formats a request in the Apache/NGINX combined log format:
+//
+//	127.0.0.1 - - [14/Oct/2026:05:20:41 +0000] "GET /get?a=1 HTTP/1.1" 200 312 "-" "curl/8.5.0"
+func (s *Server) combinedLogLine(r *http.Request, status, bytes int, start time.Time) string {
+	size := "-"
+	if bytes > 0 {
+		size = strconv.Itoa(bytes)
+	}
+
+	var b strings.Builder
+	b.WriteString(s.clientIP(r))
+	b.WriteString(" - - [")
+	b.WriteString(start.Format(combinedTimeLayout))
+	b.WriteString("] ")
+	b.WriteString(quoteLogField(r.Method + " " + r.RequestURI + " " + r.Proto))
+	b.WriteString(" ")
+	b.WriteString(strconv.Itoa(status))
+	b.WriteString(" ")
+	b.WriteString(size)
+	b.WriteString(" ")
+	b.WriteString(quoteLogField(r.Referer()))
+	b.WriteString(" ")
+	b.WriteString(quoteLogField(r.UserAgent()))
+	b.WriteString("\n")
+	return b.String()
+}
+
+// quoteLogField quotes a client supplied value, escaping quotes and control
+// characters so it can't break the line apart. Empty values are "-".
+func quoteLogField(value string) string {
+	if value == "" {
+		return `"-"`
+	}
+	return strconv.Quote(value)
+}
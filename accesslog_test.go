@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var combinedLine = regexp.MustCompile(`^(\S+) - - \[([^\]]+)\] "([^"]*)" (\d{3}) (\d+|-) "([^"]*)" "((?:[^"\\]|\\.)*)"\n$`)
+
+func TestCombinedAccessLog(t *testing.T) {
+	srv := newTestServer(t, "-access-log-format", "combined")
+	var buf bytes.Buffer
+	srv.accessLog = zapcore.AddSync(&buf)
+	handler := newTestHandler(t, srv)
+
+	req := httptest.NewRequest(http.MethodGet, "/status/418?from=test", nil)
+	req.Header.Set("Referer", "https://example.com/page")
+	req.Header.Set("User-Agent", `curl/8.5.0 "quoted"`)
+	rec := serve(handler, req)
+
+	m := combinedLine.FindStringSubmatch(buf.String())
+	if m == nil {
+		t.Fatalf("access log line %q isn't in the combined format", buf.String())
+	}
+	if m[1] != "192.0.2.1" {
+		t.Errorf("IP = %s, want 192.0.2.1", m[1])
+	}
+	if _, err := time.Parse(combinedTimeLayout, m[2]); err != nil {
+		t.Errorf("time %q: %v", m[2], err)
+	}
+	if m[3] != "GET /status/418?from=test HTTP/1.1" {
+		t.Errorf("request = %q", m[3])
+	}
+	if m[4] != "418" || m[5] != strconv.Itoa(rec.Body.Len()) {
+		t.Errorf("status %s, bytes %s, want 418 and %d", m[4], m[5], rec.Body.Len())
+	}
+	if m[6] != "https://example.com/page" {
+		t.Errorf("referer = %q", m[6])
+	}
+	// Quotes from the client are escaped, they can't end the field early
+	if m[7] != `curl/8.5.0 \"quoted\"` {
+		t.Errorf("user agent = %q", m[7])
+	}
+}
+
+func TestCombinedAccessLogEmptyFields(t *testing.T) {
+	srv := newTestServer(t, "-access-log-format", "combined")
+	var buf bytes.Buffer
+	srv.accessLog = zapcore.AddSync(&buf)
+	serve(newTestHandler(t, srv), httptest.NewRequest(http.MethodHead, "/status/204", nil))
+
+	m := combinedLine.FindStringSubmatch(buf.String())
+	if m == nil || m[5] != "-" || m[6] != "-" || m[7] != "-" {
+		t.Errorf("access log line %q, want - for the size, referer and user agent", buf.String())
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// handleAdminShutdown returns a handler that starts a graceful shutdown when
+// the request carries the admin token as "Authorization: Bearer <token>".
+// The response goes out before draining begins, since Shutdown waits for
+// this handler to finish like any other.
+func (s *Server) handleAdminShutdown(token string, shutdown func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hasAdminToken(r, token) {
+			s.writeError(w, r, ErrForbidden)
+			return
+		}
+
+		s.requestLogger(r).Warn("shutdown requested over HTTP", zap.String("ip", s.clientIP(r)))
+		s.writeResponse(w, r, http.StatusAccepted, map[string]interface{}{
+			"message":     "Shutting down",
+			"status_code": http.StatusAccepted,
+		})
+		shutdown()
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+)
+
+// allowCIDRMiddleware answers 403 to clients outside all of the networks.
+// The client is identified by clientIP, so behind trusted proxies it's the
+// forwarded address that has to match, not the proxy's.
+func (s *Server) allowCIDRMiddleware(networks []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(networks) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if ip := s.clientIP(r); !containsIP(networks, ip) {
+				s.requestLogger(r).Info("client not in allowed networks", zap.String("ip", ip))
+				s.writeError(w, r, ErrForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
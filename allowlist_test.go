@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowCIDR(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-allow-cidr", "192.0.2.0/24,2001:db8::/32", "-trusted-proxies", "10.0.0.0/8"))
+	tests := []struct {
+		name, remoteAddr, forwardedFor string
+		allowed                        bool
+	}{
+		{"allowed IPv4", "192.0.2.10:1234", "", true},
+		{"allowed IPv6", "[2001:db8::1]:1234", "", true},
+		{"blocked", "198.51.100.1:1234", "", false},
+		{"allowed behind a trusted proxy", "10.0.0.1:80", "192.0.2.10", true},
+		{"blocked behind a trusted proxy", "10.0.0.1:80", "198.51.100.1", false},
+		// An untrusted peer can't claim an allowed address
+		{"spoofed X-Forwarded-For", "198.51.100.1:1234", "192.0.2.10", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/get", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			rec := serve(handler, req)
+			if tt.allowed {
+				if rec.Code != http.StatusOK {
+					t.Errorf("status = %d, want 200", rec.Code)
+				}
+				return
+			}
+			assertError(t, rec, http.StatusForbidden, "forbidden")
+		})
+	}
+}
+
+func TestAllowCIDRUnset(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/get", nil)
+	req.RemoteAddr = "198.51.100.1:1234"
+	if rec := serve(newTestHandler(t, newTestServer(t)), req); rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200 with no allowlist", rec.Code)
+	}
+}
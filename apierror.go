@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// APIError is an error as clients get it: a stable code to act on, a
+// message for humans and the status code of the response
+type APIError struct {
+	Code    string `json:"code" xml:"code"`
+	Message string `json:"message" xml:"message"`
+	Status  int    `json:"-" xml:"-"`
+}
+
+func (e *APIError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// WithMessage returns a copy of e with a more specific message, the code
+// stays the same
+func (e *APIError) WithMessage(message string) *APIError {
+	copied := *e
+	copied.Message = message
+	return &copied
+}
+
+// The errors the server answers with. Clients should only rely on the codes,
+// messages may change.
+var (
+	ErrBadRequest           = &APIError{Code: "bad_request", Message: "Bad Request", Status: http.StatusBadRequest}
+	ErrInvalidParameter     = &APIError{Code: "invalid_parameter", Message: "Bad Request", Status: http.StatusBadRequest}
+	ErrInvalidBody          = &APIError{Code: "invalid_body", Message: "Error reading request body", Status: http.StatusBadRequest}
+	ErrUnauthorized         = &APIError{Code: "unauthorized", Message: "Unauthorized", Status: http.StatusUnauthorized}
+	ErrForbidden            = &APIError{Code: "forbidden", Message: "Forbidden", Status: http.StatusForbidden}
+	ErrNotFound             = &APIError{Code: "not_found", Message: "Not Found", Status: http.StatusNotFound}
+	ErrMethodNotAllowed     = &APIError{Code: "method_not_allowed", Message: "Method Not Allowed", Status: http.StatusMethodNotAllowed}
+	ErrConflict             = &APIError{Code: "conflict", Message: "Conflict", Status: http.StatusConflict}
+	ErrBodyTooLarge         = &APIError{Code: "body_too_large", Message: "Request Entity Too Large", Status: http.StatusRequestEntityTooLarge}
+	ErrUnsupportedMediaType = &APIError{Code: "unsupported_media_type", Message: "Unsupported Media Type", Status: http.StatusUnsupportedMediaType}
+	ErrValidationFailed     = &APIError{Code: "validation_failed", Message: "request body does not match the schema", Status: http.StatusUnprocessableEntity}
+	ErrRateLimited          = &APIError{Code: "rate_limited", Message: "Too Many Requests", Status: http.StatusTooManyRequests}
+	ErrInternal             = &APIError{Code: "internal_error", Message: "Internal Server Error", Status: http.StatusInternalServerError}
+	ErrTemplateFailed       = &APIError{Code: "template_failed", Message: "response template failed", Status: http.StatusInternalServerError}
+	ErrBadGateway           = &APIError{Code: "bad_gateway", Message: "Bad Gateway", Status: http.StatusBadGateway}
+	ErrUnavailable          = &APIError{Code: "unavailable", Message: "Service Unavailable", Status: http.StatusServiceUnavailable}
+	ErrOverloaded           = &APIError{Code: "overloaded", Message: "too many concurrent requests", Status: http.StatusServiceUnavailable}
+	ErrTimeout              = &APIError{Code: "timeout", Message: "Service Unavailable", Status: http.StatusServiceUnavailable}
+	ErrDeadlineExceeded     = &APIError{Code: "deadline_exceeded", Message: "request deadline exceeded", Status: http.StatusServiceUnavailable}
+)
+
+// errorForStatus returns the generic error of a status code, for errors
+// whose status is decided elsewhere, e.g. by the WebSocket upgrader
+func errorForStatus(status int) *APIError {
+	for _, err := range []*APIError{ErrBadRequest, ErrUnauthorized, ErrForbidden, ErrNotFound, ErrMethodNotAllowed, ErrConflict,
+		ErrBodyTooLarge, ErrUnsupportedMediaType, ErrRateLimited, ErrInternal, ErrBadGateway, ErrUnavailable} {
+		if err.Status == status {
+			return err
+		}
+	}
+	message := http.StatusText(status)
+	code := strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(strings.ToLower(message))
+	return &APIError{Code: code, Message: message, Status: status}
+}
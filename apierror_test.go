@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIErrorShape(t *testing.T) {
+	srv := newTestServer(t)
+	tests := []struct {
+		err  *APIError
+		want string
+	}{
+		{ErrMethodNotAllowed, `{"error":{"code":"method_not_allowed","message":"Method Not Allowed"},"status_code":405}`},
+		{ErrBodyTooLarge.WithMessage("body exceeds 1024 bytes"), `{"error":{"code":"body_too_large","message":"body exceeds 1024 bytes"},"status_code":413}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Code, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			srv.writeError(rec, httptest.NewRequest(http.MethodGet, "/", nil), tt.err)
+			if rec.Code != tt.err.Status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.err.Status)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.want {
+				t.Errorf("body = %s, want %s", got, tt.want)
+			}
+		})
+	}
+	if ErrBodyTooLarge.Message != "Request Entity Too Large" {
+		t.Errorf("WithMessage changed the shared error to %q", ErrBodyTooLarge.Message)
+	}
+}
+
+func TestErrorForStatus(t *testing.T) {
+	if err := errorForStatus(http.StatusNotFound); err != ErrNotFound {
+		t.Errorf("errorForStatus(404) = %v, want ErrNotFound", err)
+	}
+	if err := errorForStatus(http.StatusTeapot); err.Code != "im_a_teapot" || err.Status != http.StatusTeapot {
+		t.Errorf("errorForStatus(418) = %+v, want a code made from the status text", err)
+	}
+}
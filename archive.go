@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go.uber.org/zap"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archiveTimeLayout starts archive file names, so they sort by arrival
+const archiveTimeLayout = "20060102T150405.000000000Z"
+
+// archiveMeta is written next to every archived body
+type archiveMeta struct {
+	RequestID   string    `json:"request_id"`
+	Time        time.Time `json:"time"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	IP          string    `json:"ip"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	Status      int       `json:"status"`
+}
+
+// archiveMiddleware keeps a copy of the request body as the handler reads it
+// and writes it to dir once the handler is done, in the background so the
+// response doesn't wait for the disk. Only what the handler read is
+// archived, so the body limit applies, and an empty body isn't archived.
+// A failed write is logged and otherwise ignored.
+//
+// Every body goes to <time>-<request id><ext>, the extension following the
+// content type, together with <time>-<request id>.meta.json describing the
+// request.
+func (s *Server) archiveMiddleware(dir string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if dir == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received := time.Now().UTC()
+			var body bytes.Buffer
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(r.Body, &body), r.Body}
+			rec := &statusRecorder{ResponseWriter: w}
+
+			next.ServeHTTP(rec, r)
+
+			if body.Len() == 0 {
+				return
+			}
+			meta := archiveMeta{
+				RequestID:   requestID(r),
+				Time:        received,
+				Method:      r.Method,
+				Path:        r.URL.Path,
+				IP:          s.clientIP(r),
+				ContentType: r.Header.Get("Content-Type"),
+				Size:        body.Len(),
+				Status:      rec.Status(),
+			}
+			s.background.Add(1)
+			go func() {
+				defer s.background.Done()
+				s.writeArchive(dir, meta, body.Bytes())
+			}()
+		})
+	}
+}
+
+// writeArchive writes the body and its meta file, cleaning up after itself
+// when the disk is full or anything else goes wrong
+func (s *Server) writeArchive(dir string, meta archiveMeta, body []byte) {
+	base := filepath.Join(dir, meta.Time.Format(archiveTimeLayout)+"-"+safeFileName(meta.RequestID))
+	bodyFile := base + archiveExtension(meta.ContentType)
+	metaFile := base + ".meta.json"
+	logger := s.logger.With(zap.String("request_id", meta.RequestID), zap.String("file", bodyFile))
+
+	metaData, err := json.MarshalIndent(meta, "", "  ")
+	if err == nil {
+		err = os.WriteFile(bodyFile, body, 0o600)
+	}
+	if err == nil {
+		err = os.WriteFile(metaFile, append(metaData, '\n'), 0o600)
+	}
+	if err != nil {
+		logger.Error("failed to archive request body", zap.Error(err))
+		os.Remove(bodyFile)
+		os.Remove(metaFile)
+		return
+	}
+	logger.Debug("request body archived", zap.Int("size", len(body)))
+}
+
+// archiveExtension picks the file extension for a content type, .bin when
+// there is no well-known one
+func archiveExtension(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ".bin"
+	}
+	switch mediaType {
+	case "application/json":
+		return ".json"
+	case "text/plain":
+		return ".txt"
+	}
+	if extensions, err := mime.ExtensionsByType(mediaType); err == nil && len(extensions) > 0 {
+		return extensions[0]
+	}
+	return ".bin"
+}
+
+// safeFileName keeps letters, digits, dots, dashes and underscores of name,
+// request IDs come from clients and could otherwise point anywhere
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	dir := t.TempDir()
+	srv := newTestServer(t, "-archive-dir", dir)
+	req := httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(`{"name":"ada"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", "req-1")
+	if rec := serve(newTestHandler(t, srv), req); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	// The files are written after the response
+	srv.background.Wait()
+
+	bodies, _ := filepath.Glob(filepath.Join(dir, "*-req-1.json"))
+	if len(bodies) != 1 {
+		t.Fatalf("archived bodies = %v, want one named after the request ID", bodies)
+	}
+	if data, _ := os.ReadFile(bodies[0]); string(data) != `{"name":"ada"}` {
+		t.Errorf("archived body = %q, want the request body", data)
+	}
+	data, err := os.ReadFile(strings.TrimSuffix(bodies[0], ".json") + ".meta.json")
+	if err != nil {
+		t.Fatalf("reading the meta file: %v", err)
+	}
+	var meta archiveMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatalf("decoding the meta file: %v", err)
+	}
+	if meta.RequestID != "req-1" || meta.Method != http.MethodPost || meta.ContentType != "application/json" || meta.Size != 14 || meta.Status != http.StatusOK {
+		t.Errorf("meta = %+v", meta)
+	}
+}
+
+// A body that can't be written is logged, the response doesn't suffer
+func TestArchiveWriteFails(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srv, logs := newObservedServer(t, "-archive-dir", filepath.Join(file, "archive"))
+	rec := serve(newTestHandler(t, srv), httptest.NewRequest(http.MethodPost, "/post", strings.NewReader("data")))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+	srv.background.Wait()
+	if logs.FilterMessage("failed to archive request body").Len() != 1 {
+		t.Error("the failed write wasn't logged")
+	}
+}
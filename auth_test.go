@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBasicAuth(t *testing.T) {
+	t.Setenv("BASIC_AUTH_USERNAME", "admin")
+	t.Setenv("BASIC_AUTH_PASSWORD", "secret")
+	handler := newTestHandler(t, newTestServer(t))
+
+	tests := []struct {
+		name           string
+		user, password string
+		status         int
+	}{
+		{"missing", "", "", http.StatusUnauthorized},
+		{"wrong password", "admin", "guess", http.StatusUnauthorized},
+		{"wrong user", "root", "secret", http.StatusUnauthorized},
+		{"correct", "admin", "secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(`{}`))
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			rec := serve(handler, req)
+			if tt.status == http.StatusOK {
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status = %d, want 200, body %s", rec.Code, rec.Body)
+				}
+				return
+			}
+			assertError(t, rec, tt.status, "unauthorized")
+			if got := rec.Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, "Basic realm=") {
+				t.Errorf("WWW-Authenticate = %q, want a Basic challenge", got)
+			}
+		})
+	}
+
+	// Only /post is protected
+	if rec := serve(handler, httptest.NewRequest(http.MethodGet, "/get", nil)); rec.Code != http.StatusOK {
+		t.Errorf("GET /get status = %d, want 200 without credentials", rec.Code)
+	}
+}
+
+func TestBasicAuthUnset(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	if rec := serve(handler, httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(`{}`))); rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200 without configured credentials", rec.Code)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	t.Setenv("API_KEYS", "key-one,key-two")
+	srv, logs := newObservedServer(t)
+	handler := newTestHandler(t, srv)
+
+	tests := []struct {
+		name, key string
+		status    int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"invalid", "key-three", http.StatusUnauthorized},
+		{"valid", "key-two", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.TakeAll()
+			req := httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(`{}`))
+			if tt.key != "" {
+				req.Header.Set("X-Api-Key", tt.key)
+			}
+			rec := serve(handler, req)
+			if tt.status != http.StatusOK {
+				assertError(t, rec, tt.status, "unauthorized")
+				return
+			}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200, body %s", rec.Code, rec.Body)
+			}
+			fields := loggedRequest(t, logs)
+			if fields["api_key_id"] != apiKeyID(tt.key) {
+				t.Errorf("api_key_id = %v, want %s", fields["api_key_id"], apiKeyID(tt.key))
+			}
+			if headers := fields["headers"].(map[string][]string); headers["X-Api-Key"][0] == tt.key {
+				t.Errorf("the key itself was logged")
+			}
+		})
+	}
+}
+
+// Browsers must be allowed to send the key cross-origin
+func TestAPIKeyCORSPreflight(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	req := httptest.NewRequest(http.MethodOptions, "/post", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type,x-api-key,x-unknown")
+	rec := serve(handler, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, X-Api-Key" {
+		t.Errorf("Access-Control-Allow-Headers = %q, want the allowed subset Content-Type, X-Api-Key", got)
+	}
+}
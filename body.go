@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"time"
+)
+
+// readBody reads the whole request body up to the configured limit. When it
+// fails the response is taken care of and ok is false: 413 for an oversized
+// body, 503 once the request deadline has passed, 400 for anything else the
+// client did wrong, and nothing at all when the client went away mid-upload,
+// since there is no one left to answer.
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request) (body []byte, ok bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes)
+	start := time.Now()
+	body, err := io.ReadAll(r.Body)
+	addServerTiming(r, "read", time.Since(start))
+	if err == nil {
+		return body, true
+	}
+	s.handleBodyError(w, r, err)
+	return nil, false
+}
+
+// handleBodyError answers a failed body read as described at readBody
+func (s *Server) handleBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	var corruptErr *corruptBodyError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		s.writeError(w, r, ErrBodyTooLarge)
+	case errors.As(err, &corruptErr):
+		s.writeError(w, r, ErrInvalidBody.WithMessage("Invalid compressed request body"))
+	case clientDisconnected(r):
+		// Not a server problem, and writing would only fail with a broken pipe
+		s.requestLogger(r).Info("client disconnected while sending the body", zap.Error(err))
+		addLogFields(r, zap.Bool("client_disconnected", true))
+	case errors.Is(r.Context().Err(), context.DeadlineExceeded):
+		s.writeError(w, r, ErrDeadlineExceeded)
+	default:
+		s.writeError(w, r, ErrInvalidBody)
+	}
+}
+
+// clientDisconnected reports whether the client aborted the request. Only
+// the request's context can tell: a body cut short by an unexpected EOF is
+// just as likely a client sending less than it promised, which deserves a 400.
+// A passed -request-deadline ends the context too, but the client is still
+// there and waiting for an answer.
+func clientDisconnected(r *http.Request) bool {
+	return errors.Is(r.Context().Err(), context.Canceled)
+}
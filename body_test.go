@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-max-body-bytes", "16"))
+
+	rec := serve(handler, httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(strings.Repeat("a", 17))))
+	assertError(t, rec, http.StatusRequestEntityTooLarge, "body_too_large")
+
+	rec = serve(handler, httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(strings.Repeat("a", 16))))
+	if rec.Code != http.StatusOK {
+		t.Errorf("body at the limit: status = %d, want 200, body %s", rec.Code, rec.Body)
+	}
+}
+
+// errReader fails every read with err
+type errReader struct {
+	err error
+}
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
+
+func TestBodyReadError(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	for _, err := range []error{
+		errors.New("connection reset"),
+		// A body shorter than its Content-Length is the client's fault too
+		fmt.Errorf("reading chunk: %w", io.ErrUnexpectedEOF),
+	} {
+		t.Run(err.Error(), func(t *testing.T) {
+			rec := serve(handler, httptest.NewRequest(http.MethodPost, "/post", errReader{err}))
+			assertError(t, rec, http.StatusBadRequest, "invalid_body")
+		})
+	}
+}
+
+// Nobody is left to read an answer once the client gave up. The handler runs
+// without -handler-timeout, which would notice the cancelled request first.
+func TestBodyReadClientGone(t *testing.T) {
+	srv, logs := newObservedServer(t)
+	handler := chain(http.HandlerFunc(srv.handlePost), srv.requestIDMiddleware, srv.loggingMiddleware)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodPost, "/post", errReader{context.Canceled}).WithContext(ctx)
+	rec := serve(handler, req)
+	if rec.Body.Len() != 0 {
+		t.Errorf("wrote %q to a client that went away", rec.Body)
+	}
+	if got := loggedRequest(t, logs)["client_disconnected"]; got != true {
+		t.Errorf("client_disconnected = %v, want true", got)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// BodyParser turns a request body of some content type into a value for the
+// /post, /put and /patch responses and the request log. Parse gets the
+// request with the body already limited to -max-body-bytes.
+type BodyParser interface {
+	// CanParse reports whether the parser handles the media type, which is
+	// lower case and without parameters such as charset
+	CanParse(contentType string) bool
+	Parse(r *http.Request) (interface{}, error)
+}
+
+var (
+	bodyParsersMu sync.RWMutex
+	// bodyParsers are tried in order, the catch-all raw parser comes last
+	bodyParsers = []BodyParser{jsonParser{}, formParser{}, rawParser{}}
+)
+
+// registerBodyParser adds a parser for another content type. It is tried
+// before the built-in ones, so it can also take over one of theirs.
+func registerBodyParser(parser BodyParser) {
+	bodyParsersMu.Lock()
+	defer bodyParsersMu.Unlock()
+	bodyParsers = append([]BodyParser{parser}, bodyParsers...)
+}
+
+// bodyParserFor returns the first registered parser handling the media type
+func bodyParserFor(contentType string) BodyParser {
+	bodyParsersMu.RLock()
+	defer bodyParsersMu.RUnlock()
+	for _, parser := range bodyParsers {
+		if parser.CanParse(contentType) {
+			return parser
+		}
+	}
+	return rawParser{}
+}
+
+// jsonParser decodes JSON bodies. Unless strict, a body that isn't valid JSON
+// is kept as a string instead of failing.
+type jsonParser struct {
+	strict bool
+}
+
+func (jsonParser) CanParse(contentType string) bool {
+	return contentType == "application/json" || strings.HasSuffix(contentType, "+json")
+}
+
+func (p jsonParser) Parse(r *http.Request) (interface{}, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		if p.strict {
+			return nil, fmt.Errorf("invalid JSON body: %v", err)
+		}
+		return string(data), nil
+	}
+	return value, nil
+}
+
+// formParser decodes urlencoded forms into their fields, repeated keys keep
+// every value. curl -d labels everything as a form, so JSON bodies still
+// count as JSON.
+type formParser struct{}
+
+func (formParser) CanParse(contentType string) bool {
+	return contentType == "application/x-www-form-urlencoded"
+}
+
+func (formParser) Parse(r *http.Request) (interface{}, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if json.Valid(data) {
+		var value interface{}
+		err := json.Unmarshal(data, &value)
+		return value, err
+	}
+	form, err := url.ParseQuery(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid form body: %v", err)
+	}
+	return form, nil
+}
+
+// rawParser takes any body: JSON is decoded, anything else is kept as a string
+type rawParser struct{}
+
+func (rawParser) CanParse(string) bool {
+	return true
+}
+
+func (rawParser) Parse(r *http.Request) (interface{}, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return string(data), nil
+	}
+	return value, nil
+}
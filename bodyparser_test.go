@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFormBody(t *testing.T) {
+	srv, logs := newObservedServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/post", strings.NewReader("a=1&b=2&b=3"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := serve(newTestHandler(t, srv), req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200, body %s", rec.Code, rec.Body)
+	}
+
+	response := decodeJSON(t, rec.Body)
+	form, ok := response["form"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("form = %v, want an object", response["form"])
+	}
+	if got := form["b"].([]interface{}); len(got) != 2 || got[0] != "2" || got[1] != "3" {
+		t.Errorf("b = %v, want [2 3]", got)
+	}
+	if got := form["a"].([]interface{}); len(got) != 1 || got[0] != "1" {
+		t.Errorf("a = %v, want [1]", got)
+	}
+
+	logged, ok := loggedRequest(t, logs)["body"].(url.Values)
+	if !ok || !slices.Equal(logged["b"], []string{"2", "3"}) {
+		t.Errorf("logged body = %#v, want b with both values", loggedRequest(t, logs)["body"])
+	}
+}
+
+// JSON bodies are logged decoded and reflected as they came, without a form
+func TestJSONBody(t *testing.T) {
+	srv, logs := newObservedServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(`{"b":[2,3]}`))
+	req.Header.Set("Content-Type", "application/json")
+	response := decodeJSON(t, serve(newTestHandler(t, srv), req).Body)
+	if response["body"] != `{"b":[2,3]}` {
+		t.Errorf("body = %v, want the raw JSON", response["body"])
+	}
+	if _, ok := response["form"]; ok {
+		t.Errorf("a JSON body got a form: %v", response["form"])
+	}
+	if logged, ok := loggedRequest(t, logs)["body"].(map[string]interface{}); !ok || len(logged["b"].([]interface{})) != 2 {
+		t.Errorf("logged body = %#v, want the decoded JSON", loggedRequest(t, logs)["body"])
+	}
+}
+
+// curl -d sends JSON labeled as a form, it is still parsed as JSON
+func TestJSONBodyAsForm(t *testing.T) {
+	srv, logs := newObservedServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(`{"name":"ada"}`))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := serve(newTestHandler(t, srv), req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200, body %s", rec.Code, rec.Body)
+	}
+	if response := decodeJSON(t, rec.Body); response["form"] != nil {
+		t.Errorf("a JSON body got a form: %v", response["form"])
+	}
+	if logged, ok := loggedRequest(t, logs)["body"].(map[string]interface{}); !ok || logged["name"] != "ada" {
+		t.Errorf("logged body = %#v, want the decoded JSON", loggedRequest(t, logs)["body"])
+	}
+}
+
+// csvParser decodes CSV bodies into their records
+type csvParser struct{}
+
+func (csvParser) CanParse(contentType string) bool { return contentType == "text/csv" }
+
+func (csvParser) Parse(r *http.Request) (interface{}, error) {
+	return csv.NewReader(r.Body).ReadAll()
+}
+
+func TestRegisterBodyParser(t *testing.T) {
+	bodyParsersMu.RLock()
+	builtIn := bodyParsers
+	bodyParsersMu.RUnlock()
+	t.Cleanup(func() {
+		bodyParsersMu.Lock()
+		bodyParsers = builtIn
+		bodyParsersMu.Unlock()
+	})
+	registerBodyParser(csvParser{})
+
+	srv, logs := newObservedServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/post", strings.NewReader("a,b\n1,2\n"))
+	req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+	if rec := serve(newTestHandler(t, srv), req); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200, body %s", rec.Code, rec.Body)
+	}
+	records, ok := loggedRequest(t, logs)["body"].([][]string)
+	if !ok || len(records) != 2 || !slices.Equal(records[1], []string{"1", "2"}) {
+		t.Errorf("logged body = %#v, want the parsed records", loggedRequest(t, logs)["body"])
+	}
+
+	// Other content types still go to the built-in parsers
+	if _, ok := bodyParserFor("application/json").(jsonParser); !ok {
+		t.Errorf("application/json is no longer parsed as JSON")
+	}
+}
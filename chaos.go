@@ -0,0 +1,71 @@
+package main
+
+import (
+	"go.uber.org/zap"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// chaosPolicy holds the fault injection settings, it can be replaced while
+// requests are being served
+type chaosPolicy struct {
+	settings atomic.Pointer[chaosSettings]
+}
+
+type chaosSettings struct {
+	latency   time.Duration
+	jitter    time.Duration
+	errorRate float64
+}
+
+func newChaosPolicy(latency, jitter time.Duration, errorRate float64) *chaosPolicy {
+	policy := &chaosPolicy{}
+	policy.set(latency, jitter, errorRate)
+	return policy
+}
+
+func (p *chaosPolicy) set(latency, jitter time.Duration, errorRate float64) {
+	p.settings.Store(&chaosSettings{latency: latency, jitter: jitter, errorRate: errorRate})
+}
+
+func (p *chaosPolicy) current() chaosSettings {
+	return *p.settings.Load()
+}
+
+// chaosMiddleware injects faults to see how clients cope: every request is
+// held back by the base latency plus a random part of the jitter, then fails
+// with a 500 at the error rate. With everything at 0, the default, requests
+// pass straight through. Injected faults are added to the request log line.
+//
+// The probes are exempt, an orchestrator restarting the server would end the
+// experiment.
+func (s *Server) chaosMiddleware(policy *chaosPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s.isProbe(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			chaos := policy.current()
+
+			if delay := chaos.latency + time.Duration(s.random()*float64(chaos.jitter)); delay > 0 {
+				addLogFields(r, zap.Duration("chaos_delay", delay))
+				timer := time.NewTimer(delay)
+				select {
+				case <-timer.C:
+				case <-r.Context().Done():
+					// Nobody is left to receive a response
+					timer.Stop()
+					return
+				}
+			}
+			if chaos.errorRate > 0 && s.random() < chaos.errorRate {
+				addLogFields(r, zap.Bool("chaos_error", true))
+				s.writeError(w, r, ErrInternal)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
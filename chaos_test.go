@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// A seeded generator makes the injected faults repeatable: the same seed
+// fails the same requests with the same delays
+func TestChaos(t *testing.T) {
+	srv, logs := newObservedServer(t, "-chaos-latency", "1ms", "-chaos-jitter", "4ms", "-chaos-error-rate", "0.5")
+	srv.random = rand.New(rand.NewSource(42)).Float64
+	handler := newTestHandler(t, srv)
+	// Each request draws its jitter and then whether it fails
+	expected := rand.New(rand.NewSource(42))
+
+	failures := 0
+	for i := 0; i < 20; i++ {
+		delay := time.Millisecond + time.Duration(expected.Float64()*float64(4*time.Millisecond))
+		fail := expected.Float64() < 0.5
+
+		logs.TakeAll()
+		rec := serve(handler, httptest.NewRequest(http.MethodGet, "/get", nil))
+		logged := loggedRequest(t, logs)
+		if logged["chaos_delay"] != delay {
+			t.Errorf("request %d: chaos_delay = %v, want %v", i, logged["chaos_delay"], delay)
+		}
+		if fail {
+			failures++
+			assertError(t, rec, http.StatusInternalServerError, "internal_error")
+			if logged["chaos_error"] != true {
+				t.Errorf("request %d: the injected error wasn't logged", i)
+			}
+		} else if rec.Code != http.StatusOK {
+			t.Errorf("request %d: status = %d, want 200", i, rec.Code)
+		}
+	}
+	// The seed is known to give both outcomes
+	if failures == 0 || failures == 20 {
+		t.Errorf("%d of 20 requests failed, want some of them", failures)
+	}
+}
+
+func TestChaosOffByDefault(t *testing.T) {
+	srv, logs := newObservedServer(t)
+	srv.random = func() float64 { return 0 }
+	if rec := serve(newTestHandler(t, srv), httptest.NewRequest(http.MethodGet, "/get", nil)); rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+	if logged := loggedRequest(t, logs); logged["chaos_delay"] != nil || logged["chaos_error"] != nil {
+		t.Errorf("chaos was injected by default: %v", logged)
+	}
+}
+
+func TestChaosSparesProbes(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-chaos-latency", "1h", "-chaos-error-rate", "1"))
+	if rec := serve(handler, httptest.NewRequest(http.MethodGet, "/health", nil)); rec.Code != http.StatusOK {
+		t.Errorf("GET /health = %d, want 200", rec.Code)
+	}
+}
+
+func TestChaosDelayStopsOnCancel(t *testing.T) {
+	srv := newTestServer(t)
+	called := false
+	handler := srv.chaosMiddleware(newChaosPolicy(time.Hour, 0, 0))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		called = true
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/get", nil).WithContext(ctx))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the delay ignored the cancelled request")
+	}
+	if called {
+		t.Error("the handler ran for a cancelled request")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIP returns the address of the client that made the request. Behind
+// a load balancer RemoteAddr is the proxy, so when the peer is one of the
+// trusted proxies the forwarding headers are consulted instead.
+//
+// X-Forwarded-For is walked from the right, skipping trusted proxies, since
+// every hop appends to it: only the entries added by our own proxies can be
+// believed, anything further left may have been made up by the client.
+// X-Real-IP comes next, then the X-Origin-Proxy header older versions took
+// from any client.
+func (s *Server) clientIP(r *http.Request) string {
+	peer := remoteIP(r)
+	if !s.trustedProxy(peer) {
+		return peer
+	}
+
+	if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		hops := strings.Split(strings.Join(values, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				// A malformed entry ends the chain of trust
+				break
+			}
+			if !s.trustedProxy(hop) {
+				return hop
+			}
+			peer = hop
+		}
+		return peer
+	}
+
+	for _, name := range []string{"X-Real-IP", "X-Origin-Proxy"} {
+		if ip := strings.TrimSpace(r.Header.Get(name)); net.ParseIP(ip) != nil {
+			return ip
+		}
+	}
+	return peer
+}
+
+// remoteIP returns the IP address of the immediate peer, without the port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// trustedProxy reports whether ip belongs to one of the configured trusted proxies
+func (s *Server) trustedProxy(ip string) bool {
+	return containsIP(s.cfg.TrustedProxies, ip)
+}
+
+// containsIP reports whether ip belongs to one of the networks
+func containsIP(networks []*net.IPNet, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetworks parses CIDR ranges, a bare IP is taken as a single host.
+// what names the setting in error messages.
+func parseNetworks(values []string, what string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid %s %q", what, value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", what, value, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
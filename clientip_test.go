@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	srv := newTestServer(t, "-trusted-proxies", "10.0.0.0/8")
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		want       string
+	}{
+		{"direct client", "192.0.2.1:1234", nil, "192.0.2.1"},
+		{"peer without a port", "192.0.2.1", nil, "192.0.2.1"},
+		{"spoofed X-Forwarded-For from an untrusted peer", "192.0.2.1:1234",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.9"}, "X-Real-IP": {"203.0.113.9"}}, "192.0.2.1"},
+		{"rightmost untrusted hop wins", "10.0.0.2:1234",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.9, 198.51.100.7, 10.0.0.1"}}, "198.51.100.7"},
+		{"hops across several headers", "10.0.0.2:1234",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.9", "198.51.100.7, 10.0.0.1"}}, "198.51.100.7"},
+		{"only trusted hops", "10.0.0.2:1234",
+			map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.1"}}, "10.0.0.3"},
+		{"malformed hop ends the chain", "10.0.0.2:1234",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.9, bogus, 10.0.0.1"}}, "10.0.0.1"},
+		{"X-Real-IP fallback", "10.0.0.2:1234",
+			map[string][]string{"X-Real-IP": {"203.0.113.9"}, "X-Origin-Proxy": {"198.51.100.7"}}, "203.0.113.9"},
+		{"X-Origin-Proxy from a trusted proxy", "10.0.0.2:1234",
+			map[string][]string{"X-Origin-Proxy": {"198.51.100.7"}}, "198.51.100.7"},
+		{"X-Origin-Proxy from an untrusted peer", "192.0.2.1:1234",
+			map[string][]string{"X-Origin-Proxy": {"198.51.100.7"}}, "192.0.2.1"},
+		{"invalid X-Real-IP", "10.0.0.2:1234",
+			map[string][]string{"X-Real-IP": {"not an ip"}}, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/get", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, values := range tt.headers {
+				req.Header[http.CanonicalHeaderKey(name)] = values
+			}
+			if got := srv.clientIP(req); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Without -trusted-proxies the forwarding headers are never believed
+func TestClientIPNoTrustedProxies(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/get", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	req.Header.Set("X-Origin-Proxy", "203.0.113.9")
+	if got := newTestServer(t).clientIP(req); got != "10.0.0.2" {
+		t.Errorf("clientIP = %q, want the peer", got)
+	}
+}
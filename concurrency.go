@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// concurrencyLimitMiddleware lets at most limit requests run at the same
+// time, 0 means no limit. Once it is reached further requests get a 503
+// right away, or with queue set, wait up to queueTimeout for a slot first.
+//
+// The probes are neither limited nor counted, a saturated server shouldn't
+// look dead to the orchestrator.
+func (s *Server) concurrencyLimitMiddleware(limit int, queue bool, queueTimeout, retryAfter time.Duration) func(http.Handler) http.Handler {
+	var slots chan struct{}
+	if limit > 0 {
+		slots = make(chan struct{}, limit)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s.isProbe(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if slots != nil {
+				if !acquireSlot(r, slots, queue, queueTimeout) {
+					if r.Context().Err() == nil {
+						w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+						s.writeError(w, r, ErrOverloaded)
+					}
+					return
+				}
+				// Deferred so a panicking handler gives its slot back too
+				defer func() { <-slots }()
+			}
+
+			s.inFlight.Add(1)
+			defer s.inFlight.Add(-1)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// acquireSlot takes a slot, waiting for one up to timeout when queue is set.
+// It gives up early when the client goes away.
+func acquireSlot(r *http.Request, slots chan struct{}, queue bool, timeout time.Duration) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+	}
+	if !queue {
+		return false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
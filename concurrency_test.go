@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingHandler holds every request until release is closed, started
+// receives a value as each one begins
+func blockingHandler(started chan<- struct{}, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+}
+
+func TestConcurrencyLimitRejects(t *testing.T) {
+	srv := newTestServer(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := srv.concurrencyLimitMiddleware(2, false, 0, 3*time.Second)(blockingHandler(started, release))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(handler, httptest.NewRequest(http.MethodGet, "/get", nil))
+		}()
+		<-started
+	}
+	if got := srv.inFlight.Load(); got != 2 {
+		t.Errorf("in flight = %d, want 2", got)
+	}
+
+	rec := serve(handler, httptest.NewRequest(http.MethodGet, "/get", nil))
+	retryAfter := rec.Header().Get("Retry-After")
+	assertError(t, rec, http.StatusServiceUnavailable, "overloaded")
+	if retryAfter != "3" {
+		t.Errorf("Retry-After = %q, want 3", retryAfter)
+	}
+
+	close(release)
+	wg.Wait()
+	if got := srv.inFlight.Load(); got != 0 {
+		t.Errorf("in flight after the requests = %d, want 0", got)
+	}
+	go func() { <-started }()
+	if rec := serve(handler, httptest.NewRequest(http.MethodGet, "/get", nil)); rec.Code != http.StatusOK {
+		t.Errorf("status once the slots are free = %d, want 200", rec.Code)
+	}
+}
+
+func TestConcurrencyLimitQueues(t *testing.T) {
+	srv := newTestServer(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := srv.concurrencyLimitMiddleware(1, true, 50*time.Millisecond, time.Second)(blockingHandler(started, release))
+
+	done := make(chan struct{})
+	go func() {
+		serve(handler, httptest.NewRequest(http.MethodGet, "/get", nil))
+		close(done)
+	}()
+	<-started
+
+	// Nothing frees up within the queue timeout
+	assertError(t, serve(handler, httptest.NewRequest(http.MethodGet, "/get", nil)), http.StatusServiceUnavailable, "overloaded")
+
+	// A slot freed while waiting is taken
+	queued := make(chan int)
+	go func() {
+		queued <- serve(handler, httptest.NewRequest(http.MethodGet, "/get", nil)).Code
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	<-done
+	<-started
+	if status := <-queued; status != http.StatusOK {
+		t.Errorf("queued request status = %d, want 200", status)
+	}
+}
+
+// A panicking handler gives its slot back
+func TestConcurrencyLimitReleasesOnPanic(t *testing.T) {
+	srv := newTestServer(t)
+	handler := srv.recoverMiddleware(srv.concurrencyLimitMiddleware(1, false, 0, time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+	})))
+
+	assertError(t, serve(handler, httptest.NewRequest(http.MethodGet, "/panic", nil)), http.StatusInternalServerError, "internal_error")
+	if rec := serve(handler, httptest.NewRequest(http.MethodGet, "/get", nil)); rec.Code != http.StatusOK {
+		t.Errorf("status after a panic = %d, want 200", rec.Code)
+	}
+}
+
+// Through the full handler: with every slot taken new requests get a 503,
+// the probes still answer
+func TestConcurrencyLimitSparesProbes(t *testing.T) {
+	srv := newTestServer(t, "-max-concurrent", "2", "-overload-retry-after", "2s")
+	handler := newTestHandler(t, srv)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/get?delay=10s", nil).WithContext(ctx)
+			serve(handler, req)
+		}()
+	}
+	for start := time.Now(); srv.inFlight.Load() < 2; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("in flight = %d, want 2", srv.inFlight.Load())
+		}
+	}
+
+	rec := serve(handler, httptest.NewRequest(http.MethodPost, "/post", strings.NewReader("hi")))
+	retryAfter := rec.Header().Get("Retry-After")
+	assertError(t, rec, http.StatusServiceUnavailable, "overloaded")
+	if retryAfter != "2" {
+		t.Errorf("Retry-After = %q, want 2", retryAfter)
+	}
+	for _, path := range []string{"/health", "/readiness"} {
+		if rec := serve(handler, httptest.NewRequest(http.MethodGet, path, nil)); rec.Code != http.StatusOK {
+			t.Errorf("GET %s while saturated = %d, want 200", path, rec.Code)
+		}
+	}
+}
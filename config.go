@@ -0,0 +1,517 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Config holds the runtime settings for the server
+type Config struct {
+	Addr               string
+	BasePath           string
+	HealthAtRoot       bool
+	ShutdownTimeout    time.Duration
+	PreshutdownDelay   time.Duration
+	ReadHeaderTimeout  time.Duration
+	ReadTimeout        time.Duration
+	WriteTimeout       time.Duration
+	IdleTimeout        time.Duration
+	DisableKeepAlive   bool
+	HandlerTimeout     time.Duration
+	RequestDeadline    time.Duration
+	StreamWriteTimeout time.Duration
+	HealthCheckTimeout time.Duration
+	MaxBodyBytes       int64
+	StreamBodyBytes    int64
+	MaxHeaderBytes     int
+	CORSOrigins        []string
+	LogLevel           string
+	LogFormat          string
+	LogFile            string
+	LogMaxSize         int
+	LogMaxBackups      int
+	LogMaxAge          int
+	LogMode            string
+	AccessLogFormat    string
+	AccessLogFile      string
+	RedactHeaders      []string
+	LogRequestBody     bool
+	LogResponseBody    bool
+	MaxLogBodyBytes    int
+	LogBodyJSONPath    jsonPath
+	LogFields          []logFieldRule
+	StaticDir          string
+	StaticPrefix       string
+	StaticMaxAge       time.Duration
+	DownloadDir        string
+	MaxDelay           time.Duration
+	MetricsExclude     []string
+	StrictJSON         bool
+	Pretty             bool
+	ServerTiming       bool
+	RateLimit          float64
+	RateBurst          int
+	ChaosLatency       time.Duration
+	ChaosJitter        time.Duration
+	ChaosErrorRate     float64
+	MaxConcurrent      int
+	MaxConnections     int
+	ConcurrencyQueue   bool
+	TrailingSlash      string
+	QueueTimeout       time.Duration
+	ShedLoadAverage    float64
+	OverloadRetryAfter time.Duration
+	TrustedProxies     []*net.IPNet
+	AllowCIDRs         []*net.IPNet
+	TLSCert            string
+	TLSKey             string
+	H2C                bool
+	SecurityHeaders    bool
+	NoSniff            bool
+	ResponseHeaders    http.Header
+	PostSchema         string
+	ResponseTemplate   string
+	ArchiveDir         string
+	IdempotencyTTL     time.Duration
+	Upstream           *url.URL
+	ErrorBodies        map[int]map[string]interface{}
+	MockFiles          map[string]string
+	MIMETypes          map[string]string
+	WSMaxMessageBytes  int64
+	WSPingInterval     time.Duration
+	EnablePprof        bool
+	PprofNoAuth        bool
+	AdminAddr          string
+
+	// Secrets are only read from the environment or the config file so they
+	// don't show up in ps output
+	BasicAuthUsername string
+	BasicAuthPassword string
+	APIKeys           map[string]bool
+	AdminToken        string
+
+	// Warnings collects problems that shouldn't stop the server, they are
+	// logged once the logger exists
+	Warnings []string
+
+	// responseTemplate is ResponseTemplate parsed. Reloads compare the
+	// source, two parses of it are never equal.
+	responseTemplate *template.Template
+}
+
+// secretKeys are the config file keys that have no flag
+var secretKeys = []string{"basic-auth-username", "basic-auth-password", "api-keys", "admin-token"}
+
+// loadConfig resolves the server configuration from command line flags,
+// environment variables, an optional config file and built-in defaults, in
+// that order of precedence. Every flag can be set through an environment
+// variable named after it in upper snake case, e.g. -addr can also be set
+// with ADDR, and through a config file key of the same name.
+func loadConfig(args []string) (*Config, error) {
+	cfg := &Config{}
+	var trustedProxies, allowCIDRs, mockFiles, mimeTypes []string
+	var concurrencyMode, logBodyJSONPath, logFields, upstream string
+	var notFoundBody, methodNotAllowedBody string
+
+	fs := flag.NewFlagSet("go-simple-server", flag.ExitOnError)
+	var configPath string
+	fs.StringVar(&configPath, "config", "", "YAML or JSON config file, see the readme for the keys")
+	fs.StringVar(&cfg.Addr, "addr", ":8080", "address to listen on, e.g. :8080, 127.0.0.1:9000 or unix:/tmp/server.sock")
+	fs.StringVar(&cfg.BasePath, "base-path", "", "path prefix every route is served under, e.g. /api, none when empty")
+	fs.BoolVar(&cfg.HealthAtRoot, "health-at-root", true, "serve /health and /readiness at the root even with -base-path")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 10*time.Second, "how long to wait for in-flight requests to drain on shutdown")
+	fs.DurationVar(&cfg.PreshutdownDelay, "preshutdown-delay", 0, "how long to keep serving with /readiness failing before shutdown starts, so load balancers can deregister the server")
+	fs.DurationVar(&cfg.ReadHeaderTimeout, "read-header-timeout", 5*time.Second, "maximum time to read request headers")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", 15*time.Second, "maximum time to read the whole request, including the body")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", 15*time.Second, "maximum time to write the response")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", 60*time.Second, "how long to keep idle keep-alive connections open")
+	fs.BoolVar(&cfg.DisableKeepAlive, "disable-keepalive", false, "close every connection after one request, answering with Connection: close")
+	fs.DurationVar(&cfg.HandlerTimeout, "handler-timeout", 30*time.Second, "maximum time a handler may take before the client gets a 503, 0 disables it. Streaming endpoints are exempt")
+	fs.DurationVar(&cfg.RequestDeadline, "request-deadline", 0, "deadline of the request context, handlers give up once it passes, 0 disables it. Streaming endpoints are exempt")
+	fs.DurationVar(&cfg.StreamWriteTimeout, "stream-write-timeout", 30*time.Second, "streaming endpoints and /ws drop a client once writing to it makes no progress for this long, 0 waits forever")
+	fs.DurationVar(&cfg.HealthCheckTimeout, "health-check-timeout", 2*time.Second, "how long each subsystem check of /health may take before it counts as failed")
+	fs.Int64Var(&cfg.MaxBodyBytes, "max-body-bytes", 1<<20, "maximum accepted request body size in bytes")
+	fs.Int64Var(&cfg.StreamBodyBytes, "stream-response-bytes", 64<<10, "reflected bodies larger than this are encoded straight to the client instead of buffered first, which only saves memory with -handler-timeout 0. 0 always buffers")
+	fs.IntVar(&cfg.MaxHeaderBytes, "max-header-bytes", http.DefaultMaxHeaderBytes, "maximum size of the request line and headers in bytes")
+	fs.Var(newStringList(&cfg.CORSOrigins, "*"), "cors-origins", "comma separated origins allowed to make cross-origin requests, * allows any")
+	fs.StringVar(&cfg.LogLevel, "log-level", "info", "minimum log level: debug, info, warn or error")
+	fs.StringVar(&cfg.LogFormat, "log-format", "json", "log output format: json or console")
+	fs.StringVar(&cfg.LogFile, "log-file", "", "write logs to this file instead of stderr, rotating it by size")
+	fs.IntVar(&cfg.LogMaxSize, "log-max-size", 100, "size in megabytes at which the log file is rotated")
+	fs.IntVar(&cfg.LogMaxBackups, "log-max-backups", 3, "rotated log files to keep, 0 keeps all")
+	fs.IntVar(&cfg.LogMaxAge, "log-max-age", 28, "days to keep rotated log files, 0 keeps them regardless of age")
+	fs.StringVar(&cfg.LogMode, "log-mode", "single", "request logging: single logs one line per request once it completes, paired also logs a line when it is received")
+	fs.StringVar(&cfg.AccessLogFormat, "access-log-format", "json", "access log format: json logs requests with the application logs, combined writes Apache/NGINX combined log lines to -access-log-file")
+	fs.StringVar(&cfg.AccessLogFile, "access-log-file", "", "file for the combined access log, rotated like -log-file, stdout when empty")
+	fs.Var(newStringList(&cfg.RedactHeaders, "Authorization", "Cookie", "Set-Cookie", "X-Api-Key"), "redact-headers", "comma separated headers whose values are replaced with [REDACTED] in logs")
+	fs.BoolVar(&cfg.LogRequestBody, "log-request-body", true, "include request bodies in the request log")
+	fs.BoolVar(&cfg.LogResponseBody, "log-response-body", false, "include response bodies in the request log")
+	fs.IntVar(&cfg.MaxLogBodyBytes, "max-log-body-bytes", 4096, "logged bodies longer than this are truncated, 0 logs them in full")
+	fs.StringVar(&logBodyJSONPath, "log-body-jsonpath", "", "log only the value at this JSON path of request bodies, e.g. $.user.id, instead of the whole body")
+	fs.StringVar(&logFields, "log-fields", "", `JSON object of path prefixes to extra fields for their request log lines, e.g. {"/admin/": {"sensitive": true}}`)
+	fs.StringVar(&cfg.StaticDir, "static-dir", "", "directory of static files to serve, disabled when empty")
+	fs.StringVar(&cfg.StaticPrefix, "static-prefix", "/static/", "URL path prefix the static files are served under")
+	fs.StringVar(&cfg.DownloadDir, "download-dir", "", "directory of files served for download under /download/, disabled when empty")
+	fs.DurationVar(&cfg.StaticMaxAge, "static-max-age", 0, "how long clients may cache static files without revalidating, 0 sends no-cache")
+	fs.DurationVar(&cfg.MaxDelay, "max-delay", 30*time.Second, "upper bound for the ?delay= query parameter")
+	fs.Var(newStringList(&cfg.MetricsExclude, "/metrics"), "metrics-exclude", "comma separated routes left out of the request metrics")
+	fs.BoolVar(&cfg.StrictJSON, "strict-json", false, "require application/json bodies that parse, instead of falling back to raw strings")
+	fs.BoolVar(&cfg.Pretty, "pretty", false, "indent JSON and XML responses by default, ?pretty= overrides it per request")
+	fs.BoolVar(&cfg.ServerTiming, "server-timing", true, "add a Server-Timing header with the time spent reading the body, encoding the response and in total")
+	fs.Float64Var(&cfg.RateLimit, "rate-limit", 0, "requests per second allowed per client IP, 0 disables rate limiting")
+	fs.IntVar(&cfg.RateBurst, "rate-burst", 10, "requests a client may burst above the rate limit")
+	fs.DurationVar(&cfg.ChaosLatency, "chaos-latency", 0, "delay added to every request for chaos testing, 0 disables it")
+	fs.DurationVar(&cfg.ChaosJitter, "chaos-jitter", 0, "maximum random delay added on top of -chaos-latency")
+	fs.Float64Var(&cfg.ChaosErrorRate, "chaos-error-rate", 0, "fraction of requests, from 0 to 1, that fail with a 500 for chaos testing")
+	fs.IntVar(&cfg.MaxConcurrent, "max-concurrent", 0, "maximum number of requests handled at the same time, 0 is unlimited")
+	fs.BoolVar(&cfg.EnablePprof, "enable-pprof", false, "serve the net/http/pprof profiling endpoints under /debug/pprof/, protected by the admin token")
+	fs.BoolVar(&cfg.PprofNoAuth, "pprof-no-auth", false, "serve the profiling endpoints without the admin token, only do this on a private -admin-addr")
+	fs.StringVar(&cfg.AdminAddr, "admin-addr", "", "separate address for /health, /readiness, /metrics and the profiling endpoints, which the main one then doesn't serve, e.g. 127.0.0.1:9090")
+	fs.IntVar(&cfg.MaxConnections, "max-connections", 0, "maximum number of open client connections, further ones wait to be accepted, 0 is unlimited")
+	fs.StringVar(&cfg.TrailingSlash, "trailing-slash", "off", "what happens to paths that only miss their route by a trailing slash: off, strip, add or redirect")
+	fs.StringVar(&concurrencyMode, "concurrency-mode", "reject", "what happens to requests over -max-concurrent: reject answers 503 right away, queue waits up to -queue-timeout for a slot")
+	fs.DurationVar(&cfg.QueueTimeout, "queue-timeout", time.Second, "how long a request waits for a slot in queue mode before it gets a 503")
+	fs.Float64Var(&cfg.ShedLoadAverage, "shed-load-average", 0, "answer 503 to new requests while the 1 minute load average is above this, 0 disables it")
+	fs.DurationVar(&cfg.OverloadRetryAfter, "overload-retry-after", time.Second, "Retry-After of the 503s of -max-concurrent and -shed-load-average, rounded up to whole seconds")
+	fs.Var(newStringList(&trustedProxies), "trusted-proxies", "comma separated CIDRs of proxies whose X-Forwarded-For and X-Real-IP headers are trusted")
+	fs.Var(newStringList(&allowCIDRs), "allow-cidr", "comma separated CIDRs clients must connect from, anyone else gets a 403. Empty allows everyone")
+	fs.StringVar(&cfg.TLSCert, "tls-cert", "", "TLS certificate file, serves HTTPS together with -tls-key")
+	fs.StringVar(&cfg.TLSKey, "tls-key", "", "TLS private key file, serves HTTPS together with -tls-cert")
+	fs.BoolVar(&cfg.H2C, "h2c", false, "accept HTTP/2 without TLS (h2c) besides HTTP/1.1")
+	fs.BoolVar(&cfg.SecurityHeaders, "security-headers", false, "add common hardening headers such as X-Content-Type-Options: nosniff to every response")
+	fs.BoolVar(&cfg.NoSniff, "nosniff", false, "add X-Content-Type-Options: nosniff to every response so browsers stick to the Content-Type")
+	customHeaders := &headerList{header: make(http.Header)}
+	fs.Var(customHeaders, "response-headers", "comma separated Name: value headers added to every response")
+	fs.StringVar(&cfg.PostSchema, "post-schema", "", "JSON Schema file that /post bodies must match, disabled when empty")
+	fs.StringVar(&cfg.ResponseTemplate, "response-template", "", "Go text/template rendering the response of /post, /put and /patch from the request, e.g. {\"hello\": {{json .Body.name}}}")
+	fs.StringVar(&cfg.ArchiveDir, "archive-dir", "", "directory every /post body is archived to, disabled when empty")
+	fs.DurationVar(&cfg.IdempotencyTTL, "idempotency-ttl", 24*time.Hour, "how long the response to a POST with an Idempotency-Key header is replayed for retries, 0 disables it")
+	fs.StringVar(&upstream, "upstream", "", "URL that /proxy/ forwards requests to, disabled when empty")
+	fs.StringVar(&notFoundBody, "not-found-body", "", "JSON object sent as the body of 404 responses instead of the standard error, see the readme for placeholders")
+	fs.StringVar(&methodNotAllowedBody, "method-not-allowed-body", "", "JSON object sent as the body of 405 responses instead of the standard error")
+	fs.Int64Var(&cfg.WSMaxMessageBytes, "ws-max-message-bytes", 1<<16, "largest message /ws accepts in bytes, larger ones close the connection")
+	fs.DurationVar(&cfg.WSPingInterval, "ws-ping-interval", 30*time.Second, "how often /ws pings the client, a client that doesn't answer within twice that is dropped. 0 disables keepalive pings")
+	fs.Var(newStringList(&mockFiles), "mock-file", "comma separated /path=file mappings, each path answers with the file's contents")
+	fs.Var(newStringList(&mimeTypes), "mime-type", "comma separated .ext=type mappings overriding the Content-Type of static files, mock files and downloads, e.g. .log=text/plain")
+	fs.Parse(args)
+
+	// Remember which flags were given explicitly so the environment doesn't override them
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if !explicit["config"] {
+		configPath = os.Getenv("CONFIG")
+	}
+	fileValues := make(map[string]string)
+	if configPath != "" {
+		var err error
+		if fileValues, err = loadConfigFile(configPath); err != nil {
+			return nil, err
+		}
+		known := make(map[string]bool)
+		fs.VisitAll(func(f *flag.Flag) {
+			known[f.Name] = true
+		})
+		for _, key := range secretKeys {
+			known[key] = true
+		}
+		for _, key := range sortedKeys(fileValues) {
+			if !known[key] || key == "config" {
+				cfg.Warnings = append(cfg.Warnings, fmt.Sprintf("ignoring unknown key %q in config file %s", key, configPath))
+			}
+		}
+	}
+
+	// setting looks a value up in the environment first, then in the config file
+	setting := func(name string) (value, source string, ok bool) {
+		if value, ok := os.LookupEnv(envName(name)); ok {
+			return value, envName(name), true
+		}
+		if value, ok := fileValues[name]; ok {
+			return value, configPath + ": " + name, true
+		}
+		return "", "", false
+	}
+
+	var settingErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] || f.Name == "config" || settingErr != nil {
+			return
+		}
+		if value, source, ok := setting(f.Name); ok {
+			if err := f.Value.Set(value); err != nil {
+				settingErr = fmt.Errorf("invalid value %q for %s: %v", value, source, err)
+			}
+		}
+	})
+	if settingErr != nil {
+		return nil, settingErr
+	}
+
+	// PORT is commonly injected by orchestrators, honor it when no address was given
+	if port := os.Getenv("PORT"); port != "" && !explicit["addr"] && os.Getenv("ADDR") == "" {
+		cfg.Addr = ":" + port
+	}
+
+	cfg.BasicAuthUsername, _, _ = setting("basic-auth-username")
+	cfg.BasicAuthPassword, _, _ = setting("basic-auth-password")
+	if (cfg.BasicAuthUsername == "") != (cfg.BasicAuthPassword == "") {
+		return nil, fmt.Errorf("basic auth username and password must be set together")
+	}
+	cfg.AdminToken, _, _ = setting("admin-token")
+	apiKeys, _, _ := setting("api-keys")
+	cfg.APIKeys = make(map[string]bool)
+	for _, key := range strings.Split(apiKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			cfg.APIKeys[key] = true
+		}
+	}
+
+	if err := validateAddr(cfg.Addr); err != nil {
+		return nil, err
+	}
+	if cfg.AdminAddr != "" {
+		if err := validateAddr(cfg.AdminAddr); err != nil {
+			return nil, err
+		}
+		if cfg.AdminAddr == cfg.Addr {
+			return nil, fmt.Errorf("admin addr must differ from addr %s", cfg.Addr)
+		}
+	}
+	if cfg.EnablePprof && !cfg.PprofNoAuth && cfg.AdminToken == "" {
+		return nil, fmt.Errorf("enable pprof needs an admin token, or pprof no auth to serve the endpoints unprotected")
+	}
+	// Header names are case-insensitive, compare them in canonical form
+	for i, name := range cfg.RedactHeaders {
+		cfg.RedactHeaders[i] = http.CanonicalHeaderKey(name)
+	}
+	// The prefix is registered as a subtree, so it needs both slashes
+	// A base path of / is no base path at all
+	if cfg.BasePath = strings.TrimRight(cfg.BasePath, "/"); cfg.BasePath != "" && !strings.HasPrefix(cfg.BasePath, "/") {
+		return nil, fmt.Errorf("base path must start with /, got %q", cfg.BasePath)
+	}
+	cfg.StaticPrefix = "/" + strings.Trim(cfg.StaticPrefix, "/") + "/"
+	if cfg.StaticPrefix == "//" {
+		return nil, fmt.Errorf("static prefix must not be the root path")
+	}
+	var err error
+	if cfg.TrustedProxies, err = parseNetworks(trustedProxies, "trusted proxy"); err != nil {
+		return nil, err
+	}
+	if logBodyJSONPath != "" {
+		if cfg.LogBodyJSONPath, err = parseJSONPath(logBodyJSONPath); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ResponseTemplate != "" {
+		if cfg.responseTemplate, err = parseResponseTemplate(cfg.ResponseTemplate); err != nil {
+			return nil, err
+		}
+	}
+	if logFields != "" {
+		if cfg.LogFields, err = parseLogFields(logFields); err != nil {
+			return nil, err
+		}
+	}
+	if upstream != "" {
+		if cfg.Upstream, err = parseUpstream(upstream); err != nil {
+			return nil, fmt.Errorf("invalid upstream %q: %v", upstream, err)
+		}
+	}
+	if cfg.AllowCIDRs, err = parseNetworks(allowCIDRs, "allowed CIDR"); err != nil {
+		return nil, err
+	}
+	if cfg.MockFiles, err = parseMockFiles(mockFiles); err != nil {
+		return nil, err
+	}
+	if cfg.MIMETypes, err = parseMIMETypes(mimeTypes); err != nil {
+		return nil, err
+	}
+	cfg.ErrorBodies = make(map[int]map[string]interface{})
+	if notFoundBody != "" {
+		if cfg.ErrorBodies[http.StatusNotFound], err = parseErrorBody(notFoundBody, "not found body"); err != nil {
+			return nil, err
+		}
+	}
+	if methodNotAllowedBody != "" {
+		if cfg.ErrorBodies[http.StatusMethodNotAllowed], err = parseErrorBody(methodNotAllowedBody, "method not allowed body"); err != nil {
+			return nil, err
+		}
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return nil, fmt.Errorf("tls cert and tls key must be set together")
+	}
+
+	cfg.ResponseHeaders = make(http.Header)
+	if cfg.NoSniff {
+		cfg.ResponseHeaders.Set("X-Content-Type-Options", "nosniff")
+	}
+	if cfg.SecurityHeaders {
+		for name, value := range securityHeaders {
+			cfg.ResponseHeaders.Set(name, value)
+		}
+		// Browsers ignore HSTS over plain HTTP, only send it when serving HTTPS
+		if cfg.TLSCert != "" {
+			cfg.ResponseHeaders.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+	}
+	// Explicitly configured headers win over the built-in ones
+	for name, values := range customHeaders.header {
+		cfg.ResponseHeaders[name] = values
+	}
+	if cfg.RateLimit < 0 || cfg.RateBurst < 1 {
+		return nil, fmt.Errorf("rate limit must not be negative and burst must be at least 1")
+	}
+	if cfg.ChaosLatency < 0 || cfg.ChaosJitter < 0 {
+		return nil, fmt.Errorf("chaos latency and jitter must not be negative, got %v and %v", cfg.ChaosLatency, cfg.ChaosJitter)
+	}
+	if cfg.ChaosErrorRate < 0 || cfg.ChaosErrorRate > 1 {
+		return nil, fmt.Errorf("chaos error rate must be between 0 and 1, got %v", cfg.ChaosErrorRate)
+	}
+
+	if cfg.LogMaxSize < 1 || cfg.LogMaxBackups < 0 || cfg.LogMaxAge < 0 {
+		return nil, fmt.Errorf("log max size must be at least 1, max backups and max age must not be negative")
+	}
+	if cfg.LogMode != "single" && cfg.LogMode != "paired" {
+		return nil, fmt.Errorf("log mode must be single or paired, got %q", cfg.LogMode)
+	}
+	if cfg.AccessLogFormat != "json" && cfg.AccessLogFormat != "combined" {
+		return nil, fmt.Errorf("access log format must be json or combined, got %q", cfg.AccessLogFormat)
+	}
+	if cfg.MaxConcurrent < 0 || cfg.QueueTimeout < 0 {
+		return nil, fmt.Errorf("max concurrent and queue timeout must not be negative")
+	}
+	if cfg.ShedLoadAverage < 0 {
+		return nil, fmt.Errorf("shed load average must not be negative, got %v", cfg.ShedLoadAverage)
+	}
+	if cfg.OverloadRetryAfter <= 0 {
+		return nil, fmt.Errorf("overload retry after must be positive, got %v", cfg.OverloadRetryAfter)
+	}
+	if cfg.MaxConnections < 0 {
+		return nil, fmt.Errorf("max connections must not be negative")
+	}
+	switch cfg.TrailingSlash {
+	case "off", "strip", "add", "redirect":
+	default:
+		return nil, fmt.Errorf("trailing slash must be off, strip, add or redirect, got %q", cfg.TrailingSlash)
+	}
+	switch concurrencyMode {
+	case "reject":
+	case "queue":
+		cfg.ConcurrencyQueue = true
+	default:
+		return nil, fmt.Errorf("concurrency mode must be reject or queue, got %q", concurrencyMode)
+	}
+	if cfg.IdempotencyTTL < 0 {
+		return nil, fmt.Errorf("idempotency ttl must not be negative, got %v", cfg.IdempotencyTTL)
+	}
+	if cfg.HealthCheckTimeout <= 0 {
+		return nil, fmt.Errorf("health check timeout must be positive, got %v", cfg.HealthCheckTimeout)
+	}
+	if cfg.PreshutdownDelay < 0 {
+		return nil, fmt.Errorf("preshutdown delay must not be negative, got %v", cfg.PreshutdownDelay)
+	}
+	if cfg.StreamWriteTimeout < 0 {
+		return nil, fmt.Errorf("stream write timeout must not be negative, got %v", cfg.StreamWriteTimeout)
+	}
+	if cfg.HandlerTimeout < 0 {
+		return nil, fmt.Errorf("handler timeout must not be negative, got %v", cfg.HandlerTimeout)
+	}
+	if cfg.HandlerTimeout > 0 && cfg.MaxDelay > cfg.HandlerTimeout {
+		cfg.Warnings = append(cfg.Warnings, fmt.Sprintf("max delay %v is longer than the handler timeout %v, long ?delay= requests will get a 503", cfg.MaxDelay, cfg.HandlerTimeout))
+	}
+	if cfg.RequestDeadline < 0 {
+		return nil, fmt.Errorf("request deadline must not be negative, got %v", cfg.RequestDeadline)
+	}
+	if cfg.RequestDeadline > 0 && cfg.MaxDelay > cfg.RequestDeadline {
+		cfg.Warnings = append(cfg.Warnings, fmt.Sprintf("max delay %v is longer than the request deadline %v, long ?delay= requests will get a 503", cfg.MaxDelay, cfg.RequestDeadline))
+	}
+	if cfg.StaticMaxAge < 0 {
+		return nil, fmt.Errorf("static max age must not be negative, got %v", cfg.StaticMaxAge)
+	}
+	if cfg.MaxLogBodyBytes < 0 {
+		return nil, fmt.Errorf("max log body bytes must not be negative, got %d", cfg.MaxLogBodyBytes)
+	}
+	if cfg.WSMaxMessageBytes <= 0 {
+		return nil, fmt.Errorf("ws max message bytes must be positive, got %d", cfg.WSMaxMessageBytes)
+	}
+	if cfg.WSPingInterval < 0 {
+		return nil, fmt.Errorf("ws ping interval must not be negative, got %v", cfg.WSPingInterval)
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		return nil, fmt.Errorf("max body bytes must be positive, got %d", cfg.MaxBodyBytes)
+	}
+	if cfg.StreamBodyBytes < 0 {
+		return nil, fmt.Errorf("stream response bytes must not be negative, got %d", cfg.StreamBodyBytes)
+	}
+	if cfg.MaxHeaderBytes <= 0 {
+		return nil, fmt.Errorf("max header bytes must be positive, got %d", cfg.MaxHeaderBytes)
+	}
+	return cfg, nil
+}
+
+// envName returns the environment variable name backing the given flag
+func envName(flagName string) string {
+	return strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// validateAddr makes sure addr is a host:port pair with a usable port, or a
+// unix:/path socket, so a typo fails at startup rather than deep inside
+// ListenAndServe
+func validateAddr(addr string) error {
+	if path, ok := unixSocketPath(addr); ok {
+		if path == "" {
+			return fmt.Errorf("invalid listen address %q: missing socket path", addr)
+		}
+		return nil
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %v", addr, err)
+	}
+	if _, err := net.LookupPort("tcp", port); err != nil {
+		return fmt.Errorf("invalid listen address %q: unknown port %q", addr, port)
+	}
+	return nil
+}
+
+// stringList is a flag.Value holding a comma separated list. The first Set
+// replaces the default, later ones append so the flag can also be repeated.
+type stringList struct {
+	values *[]string
+	set    bool
+}
+
+func newStringList(values *[]string, defaults ...string) *stringList {
+	*values = defaults
+	return &stringList{values: values}
+}
+
+func (l *stringList) String() string {
+	if l == nil || l.values == nil {
+		return ""
+	}
+	return strings.Join(*l.values, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	if !l.set {
+		*l.values = nil
+		l.set = true
+	}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l.values = append(*l.values, item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unsetEnv removes the variables for the test, whatever the environment
+// running it has set. They are restored when the test ends.
+func unsetEnv(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func TestLoadConfigAddr(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{"default", nil, nil, ":8080"},
+		{"PORT", nil, map[string]string{"PORT": "3000"}, ":3000"},
+		{"ADDR over PORT", nil, map[string]string{"ADDR": ":9000", "PORT": "3000"}, ":9000"},
+		{"flag over ADDR and PORT", []string{"-addr", "127.0.0.1:7000"}, map[string]string{"ADDR": ":9000", "PORT": "3000"}, "127.0.0.1:7000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetEnv(t, "ADDR", "PORT", "CONFIG")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg, err := loadConfig(tt.args)
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			if cfg.Addr != tt.want {
+				t.Errorf("addr = %q, want %q", cfg.Addr, tt.want)
+			}
+		})
+	}
+}
+
+// Flags win over the environment, which wins over the config file, which
+// wins over the defaults
+func TestLoadConfigPrecedence(t *testing.T) {
+	unsetEnv(t, "ADDR", "PORT", "CONFIG", "READ_TIMEOUT", "WRITE_TIMEOUT", "IDLE_TIMEOUT")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	contents := "read-timeout: 1s\nwrite-timeout: 1s\nidle-timeout: 1s\n"
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WRITE_TIMEOUT", "2s")
+	t.Setenv("IDLE_TIMEOUT", "2s")
+
+	cfg, err := loadConfig([]string{"-config", path, "-idle-timeout", "3s"})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	for setting, tt := range map[string]struct{ got, want time.Duration }{
+		"read-timeout, file over default": {cfg.ReadTimeout, time.Second},
+		"write-timeout, env over file":    {cfg.WriteTimeout, 2 * time.Second},
+		"idle-timeout, flag over env":     {cfg.IdleTimeout, 3 * time.Second},
+		"read-header-timeout, default":    {cfg.ReadHeaderTimeout, 5 * time.Second},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", setting, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigUnknownKey(t *testing.T) {
+	unsetEnv(t, "ADDR", "PORT", "CONFIG")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("addr: \":9000\"\nread_timeout: 1s\nlisten-port: 80\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.Addr != ":9000" || cfg.ReadTimeout != time.Second {
+		t.Errorf("addr = %q, read timeout = %v, want the file's known keys applied", cfg.Addr, cfg.ReadTimeout)
+	}
+	if len(cfg.Warnings) != 1 || !strings.Contains(cfg.Warnings[0], `"listen-port"`) {
+		t.Errorf("warnings = %q, want one about listen-port", cfg.Warnings)
+	}
+}
+
+func TestLoadConfigInvalidAddr(t *testing.T) {
+	unsetEnv(t, "ADDR", "PORT", "CONFIG", "ADMIN_ADDR")
+	for _, args := range [][]string{
+		{"-addr", ":abc"},
+		{"-addr", "host:99999"},
+		{"-addr", "localhost"},
+		{"-addr", "unix:"},
+		{"-admin-addr", ":abc"},
+		{"-admin-addr", ":8080"},
+	} {
+		if _, err := loadConfig(args); err == nil {
+			t.Errorf("loadConfig(%q) succeeded", args)
+		}
+	}
+
+	// The environment gets the same checks
+	t.Setenv("PORT", "abc")
+	if _, err := loadConfig(nil); err == nil || !strings.Contains(err.Error(), ":abc") {
+		t.Errorf("PORT=abc: err = %v, want the address rejected", err)
+	}
+}
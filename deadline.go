@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// deadlineMiddleware puts a deadline on the request context, so handlers and
+// everything they call give up once it passes. Unlike -handler-timeout
+// nothing is cut off, the handler notices ctx.Err() and answers itself.
+func deadlineMiddleware(deadline time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if deadline <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), deadline)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
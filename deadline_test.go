@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// The handler sees the deadline through its context and answers itself
+func TestDeadlineMiddleware(t *testing.T) {
+	var ctxErr error
+	handler := deadlineMiddleware(20 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		ctxErr = r.Context().Err()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	start := time.Now()
+	rec := serve(handler, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if !errors.Is(ctxErr, context.DeadlineExceeded) {
+		t.Errorf("ctx.Err() = %v, want the deadline", ctxErr)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second || rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("answered %d after %v, want the handler's own answer right after the deadline", rec.Code, elapsed)
+	}
+}
+
+func TestRequestDeadline(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-request-deadline", "30ms"))
+	assertError(t, serve(handler, httptest.NewRequest(http.MethodGet, "/get?delay=1s", nil)), http.StatusServiceUnavailable, "deadline_exceeded")
+	if rec := serve(handler, httptest.NewRequest(http.MethodGet, "/get", nil)); rec.Code != http.StatusOK {
+		t.Errorf("GET /get within the deadline = %d, want 200", rec.Code)
+	}
+}
+
+// A body read failing after the deadline is a 503, the client is still
+// waiting, unlike one that hung up
+func TestRequestDeadlineBodyRead(t *testing.T) {
+	srv := newTestServer(t)
+	handler := chain(http.HandlerFunc(srv.handlePost), srv.requestIDMiddleware, srv.loggingMiddleware)
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPost, "/post", errReader{context.DeadlineExceeded}).WithContext(ctx)
+	assertError(t, serve(handler, req), http.StatusServiceUnavailable, "deadline_exceeded")
+}
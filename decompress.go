@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// decompressMiddleware undoes a gzip or deflate Content-Encoding of request
+// bodies, so handlers read and parse the plain bytes. The encoding headers
+// are dropped to match, a proxied request goes out uncompressed. The body
+// limit still applies to what the handler reads, the decompressed size, so a
+// small zip bomb can't blow up memory. Any other encoding gets a 415.
+func (s *Server) decompressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		switch encoding {
+		case "", "identity":
+		case "gzip", "x-gzip", "deflate":
+			if r.Body == nil || r.Body == http.NoBody {
+				break
+			}
+			r.Body = &decompressedBody{src: r.Body, encoding: encoding}
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+		default:
+			w.Header().Set("Accept-Encoding", "gzip, deflate")
+			s.writeError(w, r, ErrUnsupportedMediaType.WithMessage("Unsupported Content-Encoding"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// corruptBodyError is a request body that can't be decompressed. It doesn't
+// unwrap, an unexpected EOF in the compressed data must not pass for a client
+// that hung up.
+type corruptBodyError struct {
+	err error
+}
+
+func (e *corruptBodyError) Error() string {
+	return "corrupt compressed body: " + e.err.Error()
+}
+
+// decompressedBody decompresses src on the fly. The decompressor is created
+// on the first Read, so a broken header is reported as a read error like
+// any other problem with the body.
+type decompressedBody struct {
+	src      io.ReadCloser
+	encoding string
+	srcErr   error
+	r        io.Reader
+}
+
+func (b *decompressedBody) Read(p []byte) (int, error) {
+	if b.r == nil {
+		var err error
+		if b.r, err = b.newReader(); err != nil {
+			b.r = nil
+			// No body at all, nothing is compressed
+			if err == io.EOF {
+				return 0, io.EOF
+			}
+			return 0, b.wrap(err)
+		}
+	}
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = b.wrap(err)
+	}
+	return n, err
+}
+
+// wrap marks err as a corrupt body unless reading src itself failed
+func (b *decompressedBody) wrap(err error) error {
+	if b.srcErr != nil {
+		return err
+	}
+	return &corruptBodyError{err: err}
+}
+
+// newReader returns the decompressor of the encoding. deflate is meant to
+// be zlib wrapped, but some clients send raw deflate data, so that is
+// accepted too when the data doesn't start with a zlib header.
+func (b *decompressedBody) newReader() (io.Reader, error) {
+	src := bufio.NewReader(sourceReader{b})
+	if b.encoding != "deflate" {
+		return gzip.NewReader(src)
+	}
+	header, err := src.Peek(2)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if len(header) == 2 && header[0]&0x0f == 8 && (uint(header[0])<<8|uint(header[1]))%31 == 0 {
+		return zlib.NewReader(src)
+	}
+	return flate.NewReader(src), nil
+}
+
+func (b *decompressedBody) Close() error {
+	return b.src.Close()
+}
+
+// sourceReader reads the compressed body, remembering whether that failed
+type sourceReader struct {
+	body *decompressedBody
+}
+
+func (s sourceReader) Read(p []byte) (int, error) {
+	n, err := s.body.src.Read(p)
+	if err != nil && err != io.EOF {
+		s.body.srcErr = err
+	}
+	return n, err
+}
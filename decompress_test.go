@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// compress encodes data with gzip, zlib wrapped deflate or raw deflate
+func compress(t *testing.T, encoding string, data []byte) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	w.Write(data)
+	w.Close()
+	return &buf
+}
+
+func TestDecompressRequestBody(t *testing.T) {
+	const body = `{"name":"ada"}`
+	for _, encoding := range []string{"gzip", "deflate", "raw deflate"} {
+		t.Run(encoding, func(t *testing.T) {
+			srv, logs := newObservedServer(t)
+			req := httptest.NewRequest(http.MethodPost, "/post", compress(t, encoding, []byte(body)))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", strings.TrimPrefix(encoding, "raw "))
+			rec := serve(newTestHandler(t, srv), req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200, body %s", rec.Code, rec.Body)
+			}
+			if got := decodeJSON(t, rec.Body)["body"]; got != body {
+				t.Errorf("body = %v, want the decompressed JSON", got)
+			}
+			if logged, _ := loggedRequest(t, logs)["body"].(map[string]interface{}); logged["name"] != "ada" {
+				t.Errorf("logged body = %v, want the parsed JSON", logged)
+			}
+		})
+	}
+}
+
+func TestDecompressRequestBodyErrors(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-max-body-bytes", "1024"))
+	post := func(encoding string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/post", body)
+		req.Header.Set("Content-Encoding", encoding)
+		return serve(handler, req)
+	}
+
+	t.Run("corrupt", func(t *testing.T) {
+		assertError(t, post("gzip", strings.NewReader("not gzip at all")), http.StatusBadRequest, "invalid_body")
+	})
+	t.Run("truncated", func(t *testing.T) {
+		data := compress(t, "gzip", bytes.Repeat([]byte("a"), 100)).Bytes()
+		assertError(t, post("gzip", bytes.NewReader(data[:len(data)/2])), http.StatusBadRequest, "invalid_body")
+	})
+	// A few KiB of gzip that inflate to a MiB are held to the decompressed limit
+	t.Run("zip bomb", func(t *testing.T) {
+		assertError(t, post("gzip", compress(t, "gzip", make([]byte, 1<<20))), http.StatusRequestEntityTooLarge, "body_too_large")
+	})
+	t.Run("unknown encoding", func(t *testing.T) {
+		rec := post("br", strings.NewReader("data"))
+		assertError(t, rec, http.StatusUnsupportedMediaType, "unsupported_media_type")
+		if got := rec.Header().Get("Accept-Encoding"); got != "gzip, deflate" {
+			t.Errorf("Accept-Encoding = %q, want gzip, deflate", got)
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"go.uber.org/zap"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// downloadHandler serves the files in dir as attachments below /download/.
+// http.ServeContent answers Range requests with a 206, or a 416 when none
+// of the ranges fit the file, so interrupted downloads can resume, and
+// If-Range against the ETag makes sure they resume the same file.
+//
+// Names with a .. segment are rejected, and a symlink may not lead out of
+// dir. Directories and missing files are a 404.
+func (s *Server) downloadHandler(dir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/download/")
+		if name == "" || strings.ContainsAny(name, "\\\x00") || containsDotDot(name) {
+			s.writeError(w, r, ErrInvalidParameter.WithMessage("invalid file name"))
+			return
+		}
+		root, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			s.requestLogger(r).Error("download directory unavailable", zap.String("dir", dir), zap.Error(err))
+			s.writeError(w, r, ErrNotFound)
+			return
+		}
+		file, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil || !strings.HasPrefix(file, root+string(filepath.Separator)) {
+			s.writeError(w, r, ErrNotFound)
+			return
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			s.writeError(w, r, ErrNotFound)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			s.writeError(w, r, ErrNotFound)
+			return
+		}
+
+		w.Header().Set("ETag", fileETag(info))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": info.Name()}))
+		s.setMIMEType(w, info.Name())
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	})
+}
+
+// containsDotDot reports whether any segment of the slash separated name is ..
+func containsDotDot(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return true
+		}
+	}
+	return false
+}
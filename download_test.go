@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownload(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "data.txt"), []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	handler := newTestHandler(t, newTestServer(t, "-download-dir", dir))
+	get := func(rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/download/data.txt", nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		return serve(handler, req)
+	}
+
+	rec := get("")
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Errorf("full download = %d %q, want the whole file", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename=data.txt` {
+		t.Errorf("Content-Disposition = %q, want an attachment", got)
+	}
+	if rec.Header().Get("ETag") == "" || rec.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("ETag = %q, Accept-Ranges = %q, want both for resuming", rec.Header().Get("ETag"), rec.Header().Get("Accept-Ranges"))
+	}
+
+	rec = get("bytes=2-5")
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "2345" || rec.Header().Get("Content-Range") != "bytes 2-5/10" {
+		t.Errorf("ranged download = %d %q %q, want 206 with bytes 2-5", rec.Code, rec.Body, rec.Header().Get("Content-Range"))
+	}
+	if rec := get("bytes=100-"); rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("unsatisfiable range = %d, want 416", rec.Code)
+	}
+	assertError(t, serve(handler, httptest.NewRequest(http.MethodGet, "/download/missing.txt", nil)), http.StatusNotFound, "not_found")
+}
+
+func TestDownloadTraversal(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "public")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "secret.txt"), filepath.Join(dir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, "-download-dir", dir)
+
+	// The mux cleans .. out of paths before any handler runs
+	for _, target := range []string{"/download/../secret.txt", "/download/%2e%2e/secret.txt"} {
+		if rec := serve(newTestHandler(t, srv), httptest.NewRequest(http.MethodGet, target, nil)); strings.Contains(rec.Body.String(), "secret") && rec.Code == http.StatusOK {
+			t.Errorf("GET %s served the file outside the directory", target)
+		}
+	}
+	// The handler doesn't rely on that
+	download := srv.downloadHandler(dir)
+	req := httptest.NewRequest(http.MethodGet, "/download/x", nil)
+	req.URL.Path = "/download/../secret.txt"
+	assertError(t, serve(download, req), http.StatusBadRequest, "invalid_parameter")
+
+	// Neither may a symlink lead out of the directory
+	assertError(t, serve(download, httptest.NewRequest(http.MethodGet, "/download/link.txt", nil)), http.StatusNotFound, "not_found")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+)
+
+// EchoResponse mirrors RequestInfo but reflects exactly what the server
+// received, including every header and query value and the raw body
+type EchoResponse struct {
+	XMLName     xml.Name    `json:"-" xml:"response"`
+	Method      string      `json:"method" xml:"method"`
+	URI         string      `json:"uri" xml:"uri"`
+	Path        string      `json:"path" xml:"path"`
+	Proto       string      `json:"proto" xml:"proto"`
+	Host        string      `json:"host" xml:"host"`
+	IP          string      `json:"ip" xml:"ip"`
+	Headers     multiValues `json:"headers" xml:"headers"`
+	QueryParams multiValues `json:"query_params" xml:"query_params"`
+	Body        string      `json:"body" xml:"body"`
+	BodyLength  int         `json:"body_length" xml:"body_length"`
+}
+
+// handleEcho reflects the full request back to the client for any method,
+// which makes it easy to see what a reverse proxy actually forwards
+func (s *Server) handleEcho(w http.ResponseWriter, r *http.Request) {
+	bodyBytes, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	// One copy of the body serves the log line and the response
+	body := string(bodyBytes)
+	if body != "" {
+		setLogBody(r, body)
+	}
+
+	response := EchoResponse{
+		Method:      r.Method,
+		URI:         r.RequestURI,
+		Path:        r.URL.Path,
+		Proto:       r.Proto,
+		Host:        r.Host,
+		IP:          s.clientIP(r),
+		Headers:     multiValues(r.Header),
+		QueryParams: multiValues(r.URL.Query()),
+		Body:        body,
+		BodyLength:  len(bodyBytes),
+	}
+
+	// Answer with the same content type the client sent, writeResponse falls back to JSON or XML
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	s.writeReflectedResponse(w, r, http.StatusOK, response, len(bodyBytes))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// discardWriter is a ResponseWriter that throws the body away, so a
+// benchmark only counts the server's allocations
+type discardWriter struct {
+	header http.Header
+}
+
+func (d *discardWriter) Header() http.Header         { return d.header }
+func (d *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardWriter) WriteHeader(int)             {}
+
+// BenchmarkEchoLargeBody echoes bodies below and above the default
+// -stream-response-bytes of 64 KiB, the larger one both streamed and
+// buffered. The handler timeout is off, http.TimeoutHandler buffers every
+// response.
+func BenchmarkEchoLargeBody(b *testing.B) {
+	for _, bench := range []struct {
+		name  string
+		bytes int
+		args  []string
+	}{
+		{"32KiB", 32 << 10, nil},
+		{"1MiB", 1 << 20, nil},
+		{"1MiB buffered", 1 << 20, []string{"-stream-response-bytes", "0"}},
+	} {
+		cfg, err := loadConfig(append([]string{"-handler-timeout", "0"}, bench.args...))
+		if err != nil {
+			b.Fatal(err)
+		}
+		srv := newServer(cfg, zap.NewNop(), zap.NewAtomicLevel())
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		handler, _ := srv.newHandler(ctx, func() {}, false)
+
+		// Quotes and non-ASCII text need escaping, like real payloads do
+		body := []byte(strings.Repeat(`{"text": "héllo <wörld>"} `, bench.bytes/27+1)[:bench.bytes])
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/echo", bytes.NewReader(body))
+				handler.ServeHTTP(&discardWriter{header: make(http.Header)}, req)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// parseErrorBody parses a configured error response body, which must be a
+// JSON object
+func parseErrorBody(value, what string) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	var body map[string]interface{}
+	if err := decoder.Decode(&body); err != nil || body == nil {
+		return nil, fmt.Errorf("invalid %s: must be a JSON object", what)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("invalid %s: must be a single JSON object", what)
+	}
+	return body, nil
+}
+
+// renderErrorBody returns a copy of a configured error body with the
+// placeholders {error}, {code}, {status_code}, {method}, {path} and
+// {request_id} replaced in every string
+func renderErrorBody(body map[string]interface{}, r *http.Request, err *APIError) map[string]interface{} {
+	replacer := strings.NewReplacer(
+		"{error}", err.Message,
+		"{code}", err.Code,
+		"{status_code}", strconv.Itoa(err.Status),
+		"{method}", r.Method,
+		"{path}", r.URL.Path,
+		"{request_id}", requestID(r),
+	)
+	return renderErrorValue(body, replacer).(map[string]interface{})
+}
+
+func renderErrorValue(value interface{}, replacer *strings.Replacer) interface{} {
+	switch v := value.(type) {
+	case string:
+		return replacer.Replace(v)
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			rendered[key] = renderErrorValue(item, replacer)
+		}
+		return rendered
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered[i] = renderErrorValue(item, replacer)
+		}
+		return rendered
+	default:
+		return v
+	}
+}
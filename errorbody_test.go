@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCustomErrorBodies(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t,
+		"-not-found-body", `{"title": "{error}", "detail": {"path": "{path}", "status": "{status_code}"}, "id": "{request_id}", "retry": false}`,
+		"-method-not-allowed-body", `{"problem": "{code}", "method": "{method}"}`,
+	))
+
+	req := httptest.NewRequest(http.MethodGet, "/nope", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	rec := serve(handler, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	body := decodeJSON(t, rec.Body)
+	detail, _ := body["detail"].(map[string]interface{})
+	if body["title"] != "Not Found" || detail["path"] != "/nope" || detail["status"] != "404" || body["id"] != "req-1" || body["retry"] != false {
+		t.Errorf("404 body = %v, want the configured body with its placeholders filled in", body)
+	}
+	if _, ok := body["error"]; ok {
+		t.Errorf("404 body = %v, want no standard error next to it", body)
+	}
+
+	rec = serve(handler, httptest.NewRequest(http.MethodPost, "/get", nil))
+	if body := decodeJSON(t, rec.Body); rec.Code != http.StatusMethodNotAllowed || body["problem"] != "method_not_allowed" || body["method"] != "POST" {
+		t.Errorf("405 = %d %v, want the configured body", rec.Code, body)
+	}
+}
+
+// Other errors, and everything when nothing is configured, keep the standard
+// shape
+func TestCustomErrorBodiesFallback(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-not-found-body", `{"title": "gone"}`))
+	assertError(t, serve(handler, httptest.NewRequest(http.MethodPost, "/get", nil)), http.StatusMethodNotAllowed, "method_not_allowed")
+
+	handler = newTestHandler(t, newTestServer(t))
+	assertError(t, serve(handler, httptest.NewRequest(http.MethodGet, "/nope", nil)), http.StatusNotFound, "not_found")
+}
+
+func TestCustomErrorBodiesInvalid(t *testing.T) {
+	for _, value := range []string{`not json`, `[1, 2]`, `"text"`, `{"a": 1} {"b": 2}`} {
+		if _, err := loadConfig([]string{"-not-found-body", value}); err == nil {
+			t.Errorf("-not-found-body %q was accepted", value)
+		}
+	}
+}
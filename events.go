@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handleEvents is a Server-Sent Events stream emitting one event per
+// ?interval= (default 1s) until the client disconnects. ?event= names the
+// events, and a reconnecting client's Last-Event-ID continues the numbering.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, r, ErrBadRequest.WithMessage("streaming is not supported on this connection"))
+		return
+	}
+
+	event := r.URL.Query().Get("event")
+	if strings.ContainsAny(event, "\r\n") {
+		s.writeError(w, r, ErrInvalidParameter.WithMessage("event must not contain line breaks"))
+		return
+	}
+	interval := time.Second
+	if value := r.URL.Query().Get("interval"); value != "" {
+		var err error
+		interval, err = time.ParseDuration(value)
+		if err != nil || interval <= 0 || interval > s.cfg.MaxDelay {
+			s.writeError(w, r, ErrInvalidParameter.WithMessage("interval must be a positive duration no longer than "+s.cfg.MaxDelay.String()))
+			return
+		}
+	}
+	id := 0
+	if value := r.Header.Get("Last-Event-ID"); value != "" {
+		var err error
+		if id, err = strconv.Atoi(value); err != nil || id < 0 {
+			s.writeError(w, r, ErrInvalidParameter.WithMessage("Last-Event-ID must be a non-negative number"))
+			return
+		}
+	}
+
+	deadline := s.newStreamDeadline(w, r)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	// The body would be thrown away, don't keep the client waiting for it
+	if r.Method == http.MethodHead {
+		return
+	}
+	// Tell EventSource clients how long to wait before reconnecting
+	fmt.Fprintf(w, "retry: %d\n\n", interval.Milliseconds())
+	flusher.Flush()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		case <-s.shuttingDown:
+			return
+		}
+
+		id++
+		data, _ := json.Marshal(map[string]interface{}{
+			"id":   id,
+			"time": time.Now().UTC().Format(time.RFC3339Nano),
+		})
+		var frame strings.Builder
+		fmt.Fprintf(&frame, "id: %d\n", id)
+		if event != "" {
+			fmt.Fprintf(&frame, "event: %s\n", event)
+		}
+		fmt.Fprintf(&frame, "data: %s\n\n", data)
+		deadline.extend()
+		if _, err := w.Write([]byte(frame.String())); err != nil {
+			s.logStreamAborted(r, err, zap.Int("id", id))
+			return
+		}
+		flusher.Flush()
+	}
+}
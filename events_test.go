@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent returns the fields of the next SSE frame, up to its blank line
+func readEvent(t *testing.T, r *bufio.Reader) map[string]string {
+	t.Helper()
+	fields := make(map[string]string)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading an event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return fields
+		}
+		name, value, _ := strings.Cut(line, ": ")
+		fields[name] = value
+	}
+}
+
+func TestEvents(t *testing.T) {
+	srv, logs := newObservedServer(t)
+	ts := startTestServer(t, srv)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/events?event=tick&interval=10ms", nil)
+	req.Header.Set("Last-Event-ID", "41")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /events: %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+	if got := resp.Header.Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Cache-Control = %q, want no-cache", got)
+	}
+
+	body := bufio.NewReader(resp.Body)
+	if got := readEvent(t, body)["retry"]; got != "10" {
+		t.Errorf("retry = %q, want 10", got)
+	}
+	// The numbering continues from Last-Event-ID
+	for _, id := range []string{"42", "43"} {
+		event := readEvent(t, body)
+		if event["id"] != id || event["event"] != "tick" {
+			t.Errorf("event = %v, want id %s named tick", event, id)
+		}
+		if !strings.Contains(event["data"], `"id":`+id) {
+			t.Errorf("data = %q, want it to carry id %s", event["data"], id)
+		}
+	}
+
+	cancel()
+	for start := time.Now(); logs.FilterMessage("request received").Len() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("handler kept sending events after the client cancelled")
+		}
+	}
+}
+
+func TestEventsInvalidParams(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	tests := []struct {
+		name, query, lastEventID string
+	}{
+		{"zero interval", "interval=0s", ""},
+		{"bad interval", "interval=often", ""},
+		{"line break in the event name", "event=a%0Ab", ""},
+		{"bad Last-Event-ID", "", "abc"},
+		{"negative Last-Event-ID", "", "-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/events?"+tt.query, nil)
+			if tt.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			assertError(t, serve(handler, req), http.StatusBadRequest, "invalid_parameter")
+		})
+	}
+}
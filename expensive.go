@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// expensiveResult is what one run of the /expensive computation produces,
+// shared by every request that waited for it
+type expensiveResult struct {
+	computation int64
+	result      string
+	computedAt  time.Time
+}
+
+// handleExpensive simulates a slow computation for ?key=, taking ?duration=
+// (default 1s, at most -max-delay). Concurrent requests for the same key
+// share a single run: the first one computes and is reported as leader, the
+// others wait for its result. The computation carries on when its client
+// goes away, the others still want the result.
+func (s *Server) handleExpensive() http.HandlerFunc {
+	var group singleflight.Group
+	var computations atomic.Int64
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		key := query.Get("key")
+		if key == "" || len(key) > maxKVKeyLength {
+			s.writeError(w, r, ErrInvalidParameter.WithMessage("key must be between 1 and 256 bytes long"))
+			return
+		}
+		duration := time.Second
+		if value := query.Get("duration"); value != "" {
+			var err error
+			if duration, err = time.ParseDuration(value); err != nil || duration < 0 || duration > s.cfg.MaxDelay {
+				s.writeError(w, r, ErrInvalidParameter.WithMessage("duration must be a non-negative duration no longer than "+s.cfg.MaxDelay.String()))
+				return
+			}
+		}
+
+		leader := false
+		value, _, shared := group.Do(key, func() (interface{}, error) {
+			leader = true
+			time.Sleep(duration)
+			sum := sha256.Sum256([]byte(key))
+			return expensiveResult{
+				computation: computations.Add(1),
+				result:      hex.EncodeToString(sum[:]),
+				computedAt:  time.Now().UTC(),
+			}, nil
+		})
+		result := value.(expensiveResult)
+		addLogFields(r, zap.Bool("expensive_leader", leader))
+
+		s.writeResponse(w, r, http.StatusOK, map[string]interface{}{
+			"key":         key,
+			"result":      result.result,
+			"computation": result.computation,
+			"computed_at": result.computedAt.Format(time.RFC3339Nano),
+			"leader":      leader,
+			"shared":      shared,
+			"status_code": http.StatusOK,
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestExpensiveCoalesces(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	const callers = 10
+	responses := make([]map[string]interface{}, callers)
+	var start, done sync.WaitGroup
+	start.Add(1)
+	for i := range responses {
+		done.Add(1)
+		go func(i int) {
+			defer done.Done()
+			start.Wait()
+			rec := serve(handler, httptest.NewRequest(http.MethodGet, "/expensive?key=x&duration=300ms", nil))
+			responses[i] = decodeJSON(t, rec.Body)
+		}(i)
+	}
+	start.Done()
+	done.Wait()
+
+	leaders := 0
+	for _, response := range responses {
+		if response["computation"] != float64(1) || response["result"] != responses[0]["result"] || response["shared"] != true {
+			t.Errorf("response = %v, want the shared result of the one computation", response)
+		}
+		if response["leader"] == true {
+			leaders++
+		}
+	}
+	if leaders != 1 {
+		t.Errorf("%d leaders, want 1", leaders)
+	}
+
+	// Once the run is over the next request computes again, on its own
+	response := decodeJSON(t, serve(handler, httptest.NewRequest(http.MethodGet, "/expensive?key=x&duration=0s", nil)).Body)
+	if response["computation"] != float64(2) || response["leader"] != true || response["shared"] != false {
+		t.Errorf("later request = %v, want a second computation it leads alone", response)
+	}
+}
+
+func TestExpensiveInvalidParams(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-max-delay", "1s"))
+	for _, target := range []string{"/expensive", "/expensive?key=x&duration=soon", "/expensive?key=x&duration=2s"} {
+		assertError(t, serve(handler, httptest.NewRequest(http.MethodGet, target, nil)), http.StatusBadRequest, "invalid_parameter")
+	}
+}
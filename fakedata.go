@@ -0,0 +1,164 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxFakeCount caps ?count= of /mock
+const maxFakeCount = 1000
+
+// fakeEpoch is the earliest creation time of fake records, a fixed date so
+// a seed always yields the same timestamps
+var fakeEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	fakeFirstNames = []string{"Ada", "Alan", "Barbara", "Claude", "Dennis", "Edsger", "Frances", "Grace", "Hedy", "John", "Ken", "Linus", "Margaret", "Niklaus", "Radia", "Tim"}
+	fakeLastNames  = []string{"Lovelace", "Turing", "Liskov", "Shannon", "Ritchie", "Dijkstra", "Allen", "Hopper", "Lamarr", "Backus", "Thompson", "Torvalds", "Hamilton", "Wirth", "Perlman", "Berners-Lee"}
+	fakeCities     = []string{"Amsterdam", "Berlin", "Chicago", "Dublin", "Lisbon", "Melbourne", "Nairobi", "Osaka", "Paris", "Seoul", "Toronto", "Zurich"}
+	fakeAdjectives = []string{"Compact", "Durable", "Ergonomic", "Lightweight", "Portable", "Rugged", "Sleek", "Smart", "Vintage", "Wireless"}
+	fakeProducts   = map[string][]string{
+		"books":       {"Notebook", "Cookbook", "Novel", "Atlas"},
+		"electronics": {"Headphones", "Keyboard", "Monitor", "Speaker"},
+		"garden":      {"Hose", "Shovel", "Planter", "Sprinkler"},
+		"kitchen":     {"Kettle", "Knife", "Mug", "Skillet"},
+	}
+	fakeOrderStatuses = []string{"pending", "paid", "shipped", "delivered", "cancelled"}
+)
+
+// fakeGenerators are the types /mock knows, each turning the record number
+// and the seeded RNG into a record. Records are structs so the order of their
+// fields is as stable as the values.
+var fakeGenerators = map[string]func(id int, rng *rand.Rand) interface{}{
+	"users":    fakeUser,
+	"products": fakeProduct,
+	"orders":   fakeOrder,
+}
+
+type fakeUserRecord struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Age       int    `json:"age"`
+	City      string `json:"city"`
+	CreatedAt string `json:"created_at"`
+}
+
+type fakeProductRecord struct {
+	ID       int     `json:"id"`
+	Name     string  `json:"name"`
+	Category string  `json:"category"`
+	Price    float64 `json:"price"`
+	InStock  bool    `json:"in_stock"`
+}
+
+type fakeOrderRecord struct {
+	ID        int     `json:"id"`
+	UserID    int     `json:"user_id"`
+	ProductID int     `json:"product_id"`
+	Quantity  int     `json:"quantity"`
+	Total     float64 `json:"total"`
+	Status    string  `json:"status"`
+	CreatedAt string  `json:"created_at"`
+}
+
+func fakeUser(id int, rng *rand.Rand) interface{} {
+	first := fakeFirstNames[rng.Intn(len(fakeFirstNames))]
+	last := fakeLastNames[rng.Intn(len(fakeLastNames))]
+	return fakeUserRecord{
+		ID:        id,
+		Name:      first + " " + last,
+		Email:     strings.ToLower(first+"."+last) + strconv.Itoa(id) + "@example.com",
+		Age:       18 + rng.Intn(63),
+		City:      fakeCities[rng.Intn(len(fakeCities))],
+		CreatedAt: fakeTime(rng),
+	}
+}
+
+func fakeProduct(id int, rng *rand.Rand) interface{} {
+	categories := sortedKeys(fakeProducts)
+	category := categories[rng.Intn(len(categories))]
+	names := fakeProducts[category]
+	return fakeProductRecord{
+		ID:       id,
+		Name:     fakeAdjectives[rng.Intn(len(fakeAdjectives))] + " " + names[rng.Intn(len(names))],
+		Category: category,
+		Price:    fakePrice(rng, 1, 500),
+		InStock:  rng.Intn(4) > 0,
+	}
+}
+
+func fakeOrder(id int, rng *rand.Rand) interface{} {
+	quantity := 1 + rng.Intn(5)
+	price := fakePrice(rng, 1, 500)
+	return fakeOrderRecord{
+		ID:        id,
+		UserID:    1 + rng.Intn(100),
+		ProductID: 1 + rng.Intn(100),
+		Quantity:  quantity,
+		Total:     math.Round(price*float64(quantity)*100) / 100,
+		Status:    fakeOrderStatuses[rng.Intn(len(fakeOrderStatuses))],
+		CreatedAt: fakeTime(rng),
+	}
+}
+
+// fakePrice is a price between low and high, rounded to cents
+func fakePrice(rng *rand.Rand, low, high float64) float64 {
+	return math.Round((low+rng.Float64()*(high-low))*100) / 100
+}
+
+// fakeTime is a time within a year after fakeEpoch
+func fakeTime(rng *rand.Rand) string {
+	return fakeEpoch.Add(time.Duration(rng.Int63n(int64(365 * 24 * time.Hour)))).Truncate(time.Second).Format(time.RFC3339)
+}
+
+// handleFakeData generates ?count= fake records of ?type=, e.g.
+// /mock?type=users&count=10&seed=42. The same seed always yields the same
+// records, for stable snapshot tests. Without one a random seed is used, it
+// is part of the response so the data can be had again.
+func (s *Server) handleFakeData(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	kind := query.Get("type")
+	generate, ok := fakeGenerators[kind]
+	if !ok {
+		s.writeError(w, r, ErrInvalidParameter.WithMessage("type must be one of "+strings.Join(sortedKeys(fakeGenerators), ", ")))
+		return
+	}
+
+	count := 10
+	if value := query.Get("count"); value != "" {
+		var err error
+		count, err = strconv.Atoi(value)
+		if err != nil || count < 1 || count > maxFakeCount {
+			s.writeError(w, r, ErrInvalidParameter.WithMessage("count must be a number between 1 and "+strconv.Itoa(maxFakeCount)))
+			return
+		}
+	}
+
+	// Small enough to stay exact as a JavaScript number
+	seed := rand.Int63n(1 << 53)
+	if value := query.Get("seed"); value != "" {
+		var err error
+		if seed, err = strconv.ParseInt(value, 10, 64); err != nil {
+			s.writeError(w, r, ErrInvalidParameter.WithMessage("seed must be a number"))
+			return
+		}
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	records := make([]interface{}, count)
+	for i := range records {
+		records[i] = generate(i+1, rng)
+	}
+	s.writeResponse(w, r, http.StatusOK, map[string]interface{}{
+		"type":        kind,
+		"count":       count,
+		"seed":        seed,
+		"data":        records,
+		"status_code": http.StatusOK,
+	})
+}
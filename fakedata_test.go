@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFakeDataDeterministic(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	get := func(target string) string {
+		rec := serve(handler, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d, want 200", target, rec.Code)
+		}
+		return rec.Body.String()
+	}
+
+	for _, kind := range []string{"users", "products", "orders"} {
+		t.Run(kind, func(t *testing.T) {
+			target := "/mock?type=" + kind + "&count=5&seed=42"
+			first := get(target)
+			if second := get(target); second != first {
+				t.Errorf("the same seed gave\n%s\nand\n%s", first, second)
+			}
+			if other := get("/mock?type=" + kind + "&count=5&seed=43"); other == first {
+				t.Error("another seed gave the same records")
+			}
+		})
+	}
+
+	// A snapshot, any change to the generator shows here
+	const snapshot = `{"count":1,"data":[{"id":1,"name":"Radia Perlman","email":"radia.perlman1@example.com","age":27,"city":"Dublin","created_at":"2024-03-19T00:49:49Z"}],"seed":7,"status_code":200,"type":"users"}`
+	if got := strings.TrimSpace(get("/mock?type=users&count=1&seed=7")); got != snapshot {
+		t.Errorf("seed 7 = %s, want %s", got, snapshot)
+	}
+}
+
+// Without a seed the response tells which one was used, and it repeats the data
+func TestFakeDataRandomSeed(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	first := decodeJSON(t, serve(handler, httptest.NewRequest(http.MethodGet, "/mock?type=products&count=2", nil)).Body)
+	seed := strconv.FormatFloat(first["seed"].(float64), 'f', 0, 64)
+	again := decodeJSON(t, serve(handler, httptest.NewRequest(http.MethodGet, "/mock?type=products&count=2&seed="+seed, nil)).Body)
+	if len(first["data"].([]interface{})) != 2 || !reflect.DeepEqual(again["data"], first["data"]) {
+		t.Errorf("replaying seed %v gave %v, want %v", first["seed"], again["data"], first["data"])
+	}
+}
+
+func TestFakeDataInvalidParams(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	for _, target := range []string{"/mock", "/mock?type=cats", "/mock?type=users&count=0", "/mock?type=users&count=1001", "/mock?type=users&seed=x"} {
+		assertError(t, serve(handler, httptest.NewRequest(http.MethodGet, target, nil)), http.StatusBadRequest, "invalid_parameter")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// flakyStore counts the attempts per key behind /flaky, for testing client
+// retries. The counts live as long as the server unless they are reset.
+type flakyStore struct {
+	server *Server
+
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+func newFlakyStore(server *Server) *flakyStore {
+	return &flakyStore{server: server, attempts: make(map[string]int)}
+}
+
+// ServeHTTP fails the first ?fail= (default 1) requests for ?key= with a
+// 503 and answers 200 from then on, whatever the method. DELETE resets the
+// count of the key.
+func (f *flakyStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	key := query.Get("key")
+	if key == "" || len(key) > maxKVKeyLength {
+		f.server.writeError(w, r, ErrInvalidParameter.WithMessage("key must be between 1 and 256 bytes long"))
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		f.mu.Lock()
+		_, existed := f.attempts[key]
+		delete(f.attempts, key)
+		f.mu.Unlock()
+		if !existed {
+			f.server.writeError(w, r, ErrNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	fail := 1
+	if value := query.Get("fail"); value != "" {
+		var err error
+		if fail, err = strconv.Atoi(value); err != nil || fail < 0 {
+			f.server.writeError(w, r, ErrInvalidParameter.WithMessage("fail must be a non-negative number"))
+			return
+		}
+	}
+
+	f.mu.Lock()
+	f.attempts[key]++
+	attempt := f.attempts[key]
+	f.mu.Unlock()
+
+	response := map[string]interface{}{
+		"key":     key,
+		"attempt": attempt,
+		"fail":    fail,
+	}
+	status := http.StatusOK
+	if attempt <= fail {
+		status = http.StatusServiceUnavailable
+		response["error"] = ErrUnavailable
+	}
+	response["status_code"] = status
+	f.server.writeResponse(w, r, status, response)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFlaky(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	get := func(target string) (int, map[string]interface{}) {
+		rec := serve(handler, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Code, decodeJSON(t, rec.Body)
+	}
+
+	// Three failures, then success for good
+	for attempt, want := range []int{503, 503, 503, 200, 200} {
+		status, body := get("/flaky?key=abc&fail=3")
+		if status != want || body["attempt"] != float64(attempt+1) || body["status_code"] != float64(want) {
+			t.Errorf("attempt %d = %d %v, want %d", attempt+1, status, body, want)
+		}
+	}
+	// Keys are counted on their own
+	if status, body := get("/flaky?key=other&fail=3"); status != http.StatusServiceUnavailable || body["attempt"] != float64(1) {
+		t.Errorf("another key = %d %v, want its first failure", status, body)
+	}
+
+	rec := serve(handler, httptest.NewRequest(http.MethodDelete, "/flaky?key=abc", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE = %d, want 204", rec.Code)
+	}
+	if status, body := get("/flaky?key=abc&fail=3"); status != http.StatusServiceUnavailable || body["attempt"] != float64(1) {
+		t.Errorf("after the reset = %d %v, want the first failure again", status, body)
+	}
+	assertError(t, serve(handler, httptest.NewRequest(http.MethodDelete, "/flaky?key=unknown", nil)), http.StatusNotFound, "not_found")
+}
+
+func TestFlakyInvalidParams(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	for _, target := range []string{"/flaky", "/flaky?key=a&fail=-1", "/flaky?key=a&fail=x"} {
+		assertError(t, serve(handler, httptest.NewRequest(http.MethodGet, target, nil)), http.StatusBadRequest, "invalid_parameter")
+	}
+}
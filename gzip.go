@@ -0,0 +1,216 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gzipMinSize is the smallest response worth compressing, below that the
+// gzip framing costs about as much as it saves
+const gzipMinSize = 1024
+
+var gzipWriterPool = sync.Pool{
+	New: func() any { return gzip.NewWriter(io.Discard) },
+}
+
+// gzipMiddleware compresses responses for clients advertising gzip support
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Caches must not hand a compressed response to a client that can't read it
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether the Accept-Encoding header allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		// gzip;q=0 explicitly refuses the encoding
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter holds back the start of a response until it knows
+// whether compressing it pays off: it must be large enough and not already
+// compressed. The decision is made at the latest when the response is flushed
+// or the handler returns.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	// 1xx responses and superfluous calls go straight through
+	if g.decided || status < 200 {
+		g.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if g.status != 0 {
+		return
+	}
+	g.status = status
+	// These responses never carry a body worth compressing
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		g.decide(false)
+	}
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !g.decided {
+		g.buf = append(g.buf, b...)
+		if len(g.buf) >= gzipMinSize {
+			if err := g.decide(g.compressible()); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	}
+	if g.gz != nil {
+		return g.gz.Write(b)
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+// Flush commits to a decision and pushes everything written so far to the client
+func (g *gzipResponseWriter) Flush() {
+	if !g.decided {
+		g.decide(g.compressible())
+	}
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	if flusher, ok := g.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// Close sends whatever is still buffered and terminates the gzip stream, it
+// must run once the handler has returned or the body ends up truncated
+func (g *gzipResponseWriter) Close() error {
+	if !g.decided {
+		// Nothing was written at all, let net/http send its implicit 200
+		if g.status == 0 && len(g.buf) == 0 {
+			return nil
+		}
+		// The whole response fit in the buffer, so it is too small to compress
+		if err := g.decide(false); err != nil {
+			return err
+		}
+	}
+	if g.gz == nil {
+		return nil
+	}
+	err := g.gz.Close()
+	g.gz.Reset(io.Discard)
+	gzipWriterPool.Put(g.gz)
+	g.gz = nil
+	return err
+}
+
+// compressible reports whether the buffered response should be compressed
+func (g *gzipResponseWriter) compressible() bool {
+	h := g.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	// The handler asked for the body to arrive exactly as written
+	if strings.Contains(strings.ToLower(h.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(g.buf)
+	}
+	return !alreadyCompressed(contentType)
+}
+
+// decide sends the headers and the buffered bytes, compressed or not
+func (g *gzipResponseWriter) decide(compress bool) error {
+	g.decided = true
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+
+	h := g.Header()
+	if compress {
+		// net/http would otherwise sniff the type from the compressed bytes
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(g.buf))
+		}
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		g.gz = gzipWriterPool.Get().(*gzip.Writer)
+		g.gz.Reset(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+
+	buf := g.buf
+	g.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if g.gz != nil {
+		_, err = g.gz.Write(buf)
+	} else {
+		_, err = g.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// alreadyCompressed reports whether a content type is already compressed, so
+// running it through gzip again would only waste CPU
+func alreadyCompressed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "audio/"):
+		return true
+	}
+	switch mediaType {
+	case "application/gzip", "application/x-gzip", "application/zip",
+		"application/x-bzip2", "application/x-xz", "application/zstd",
+		"application/x-7z-compressed", "application/pdf",
+		"font/woff", "font/woff2":
+		return true
+	}
+	return false
+}
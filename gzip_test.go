@@ -0,0 +1,75 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzipCompressesLargeResponses(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	body := strings.Repeat("compress me ", 500)
+	req := httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(body))
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := serve(handler, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if rec.Header().Get("Content-Length") != "" {
+		t.Errorf("Content-Length is set on a compressed response")
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.NewDecoder(zr).Decode(&decoded); err != nil {
+		t.Fatalf("decoding the decompressed body: %v", err)
+	}
+	if decoded["body"] != body {
+		t.Errorf("decompressed body doesn't reflect the request")
+	}
+	// A truncated stream fails the checksum at the end
+	if _, err := io.Copy(io.Discard, zr); err != nil {
+		t.Errorf("reading to the end of the gzip stream: %v", err)
+	}
+}
+
+func TestGzipSkips(t *testing.T) {
+	large := strings.Repeat("x", 2*gzipMinSize)
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+	}{
+		{"small response", "gzip", "text/plain", "tiny"},
+		{"already compressed", "gzip", "image/png", large},
+		{"not accepted", "", "text/plain", large},
+		{"refused with q=0", "gzip;q=0", "text/plain", large},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				io.WriteString(w, tt.body)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := serve(handler, req)
+			if got := rec.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("Content-Encoding = %q, want none", got)
+			}
+			if rec.Body.String() != tt.body {
+				t.Errorf("body changed: got %d bytes, want %d", rec.Body.Len(), len(tt.body))
+			}
+		})
+	}
+}
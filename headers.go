@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// securityHeaders are the hardening headers set by -security-headers. They
+// suit an API: nothing served here is meant to be framed or sniffed.
+var securityHeaders = map[string]string{
+	"X-Content-Type-Options":     "nosniff",
+	"X-Frame-Options":            "DENY",
+	"Referrer-Policy":            "no-referrer",
+	"Cross-Origin-Opener-Policy": "same-origin",
+}
+
+// headerList is a flag.Value holding "Name: value" pairs separated by commas.
+// Header values may contain commas themselves, so a comma only starts a new
+// pair when what follows looks like "Name:".
+type headerList struct {
+	header http.Header
+}
+
+func (l *headerList) String() string {
+	if l == nil || l.header == nil {
+		return ""
+	}
+	var pairs []string
+	for name, values := range l.header {
+		for _, value := range values {
+			pairs = append(pairs, name+": "+value)
+		}
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func (l *headerList) Set(value string) error {
+	var pairs []string
+	for _, part := range strings.Split(value, ",") {
+		if len(pairs) > 0 && !startsHeaderPair(part) {
+			pairs[len(pairs)-1] += "," + part
+			continue
+		}
+		pairs = append(pairs, part)
+	}
+
+	for _, pair := range pairs {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, ":")
+		name = strings.TrimSpace(name)
+		if !ok || !validHeaderName(name) {
+			return fmt.Errorf("%q is not a Name: value header", strings.TrimSpace(pair))
+		}
+		l.header.Add(name, strings.TrimSpace(value))
+	}
+	return nil
+}
+
+// startsHeaderPair reports whether s begins with a header name and a colon
+func startsHeaderPair(s string) bool {
+	name, _, ok := strings.Cut(s, ":")
+	return ok && validHeaderName(strings.TrimSpace(name))
+}
+
+// validHeaderName reports whether name is a non-empty HTTP token
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// responseHeadersMiddleware adds static headers to every response. They are
+// set before the handler runs, so they are in place whenever it writes, and a
+// handler can still override them.
+func responseHeadersMiddleware(headers http.Header) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(headers) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for name, values := range headers {
+				w.Header()[name] = append([]string(nil), values...)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
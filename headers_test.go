@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestResponseHeaders(t *testing.T) {
+	t.Setenv("RESPONSE_HEADERS", "X-From-Env: yes")
+	handler := newTestHandler(t, newTestServer(t, "-security-headers", "-response-headers", "X-Custom: a, b, X-Frame-Options: SAMEORIGIN"))
+
+	for _, path := range []string{"/get", "/does-not-exist"} {
+		t.Run(path, func(t *testing.T) {
+			rec := serve(handler, httptest.NewRequest(http.MethodGet, path, nil))
+			for name, want := range map[string]string{
+				"X-Content-Type-Options": "nosniff",
+				"Referrer-Policy":        "no-referrer",
+				// A configured header wins over the built-in one
+				"X-Frame-Options": "SAMEORIGIN",
+				// The comma inside the value doesn't start a new header
+				"X-Custom": "a, b",
+			} {
+				if got := rec.Header().Values(name); !slices.Equal(got, []string{want}) {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			// Flags take precedence over the environment
+			if got := rec.Header().Get("X-From-Env"); got != "" {
+				t.Errorf("X-From-Env = %q, want the flag to replace the environment", got)
+			}
+		})
+	}
+}
+
+func TestResponseHeadersFromEnv(t *testing.T) {
+	t.Setenv("RESPONSE_HEADERS", "X-From-Env: yes")
+	rec := serve(newTestHandler(t, newTestServer(t)), httptest.NewRequest(http.MethodGet, "/get", nil))
+	if got := rec.Header().Get("X-From-Env"); got != "yes" {
+		t.Errorf("X-From-Env = %q, want yes", got)
+	}
+	if got := rec.Header().Get("X-Frame-Options"); got != "" {
+		t.Errorf("security headers are on by default: X-Frame-Options = %q", got)
+	}
+}
+
+func TestResponseHeadersInvalid(t *testing.T) {
+	for _, value := range []string{"no colon", "Bad Name: x", ": empty name"} {
+		list := &headerList{header: make(http.Header)}
+		if err := list.Set(value); err == nil {
+			t.Errorf("-response-headers %q was accepted as %v", value, list.header)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// HealthChecker is a subsystem /health reports on. Check should give up once
+// ctx is done, /health stops waiting for it at that point anyway.
+type HealthChecker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+// registeredCheck is a HealthChecker with whether its failure makes the whole
+// server unhealthy or only degraded
+type registeredCheck struct {
+	checker  HealthChecker
+	critical bool
+}
+
+// healthCheckFunc turns a function into a HealthChecker
+type healthCheckFunc struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+func (f healthCheckFunc) Name() string                    { return f.name }
+func (f healthCheckFunc) Check(ctx context.Context) error { return f.check(ctx) }
+
+// registerHealthCheck adds checker to /health. Checks are registered while
+// the server is set up, before it serves requests.
+func (s *Server) registerHealthCheck(checker HealthChecker, critical bool) {
+	s.healthChecks = append(s.healthChecks, registeredCheck{checker: checker, critical: critical})
+}
+
+// healthResult is the outcome of one check as reported by /health
+type healthResult struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+}
+
+// runHealthChecks runs every registered check at the same time, each with
+// timeout, and returns their results by name and the overall status: healthy
+// when all pass, degraded when only non-critical ones fail and unhealthy
+// when a critical one fails.
+func (s *Server) runHealthChecks(ctx context.Context, timeout time.Duration) (string, map[string]healthResult) {
+	type outcome struct {
+		check registeredCheck
+		err   error
+	}
+	outcomes := make(chan outcome, len(s.healthChecks))
+	for _, check := range s.healthChecks {
+		go func(check registeredCheck) {
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			done := make(chan error, 1)
+			go func() { done <- check.checker.Check(checkCtx) }()
+			select {
+			case err := <-done:
+				outcomes <- outcome{check, err}
+			case <-checkCtx.Done():
+				outcomes <- outcome{check, checkCtx.Err()}
+			}
+		}(check)
+	}
+
+	status := "healthy"
+	results := make(map[string]healthResult, len(s.healthChecks))
+	for range s.healthChecks {
+		o := <-outcomes
+		result := healthResult{Status: "ok", Critical: o.check.critical}
+		if o.err != nil {
+			result.Status, result.Error = "failed", o.err.Error()
+			if o.check.critical {
+				status = "unhealthy"
+			} else if status == "healthy" {
+				status = "degraded"
+			}
+		}
+		results[o.check.checker.Name()] = result
+	}
+	return status, results
+}
+
+// upstreamHealthCheck checks that the -upstream host accepts connections
+func upstreamHealthCheck(upstream *url.URL) HealthChecker {
+	return healthCheckFunc{name: "upstream", check: func(ctx context.Context) error {
+		return checkReachable(ctx, upstream)
+	}}
+}
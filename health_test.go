@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// stubChecker fails with err, or blocks until ctx is done when slow
+type stubChecker struct {
+	name string
+	err  error
+	slow bool
+}
+
+func (c stubChecker) Name() string { return c.name }
+
+func (c stubChecker) Check(ctx context.Context) error {
+	if c.slow {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return c.err
+}
+
+func TestHealthChecks(t *testing.T) {
+	broken := errors.New("broken")
+	tests := []struct {
+		name     string
+		checks   []registeredCheck
+		status   int
+		health   string
+		failures []string
+		// errorContains is part of every failed check's error
+		errorContains string
+	}{
+		{"passing", []registeredCheck{{stubChecker{name: "db"}, true}, {stubChecker{name: "cache"}, false}}, http.StatusOK, "healthy", nil, ""},
+		{"non-critical failing", []registeredCheck{{stubChecker{name: "db"}, true}, {stubChecker{name: "cache", err: broken}, false}}, http.StatusOK, "degraded", []string{"cache"}, "broken"},
+		{"critical failing", []registeredCheck{{stubChecker{name: "db", err: broken}, true}, {stubChecker{name: "cache", err: broken}, false}}, http.StatusServiceUnavailable, "unhealthy", []string{"db", "cache"}, "broken"},
+		{"critical too slow", []registeredCheck{{stubChecker{name: "db", slow: true}, true}}, http.StatusServiceUnavailable, "unhealthy", []string{"db"}, "deadline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, "-health-check-timeout", "20ms")
+			for _, check := range tt.checks {
+				srv.registerHealthCheck(check.checker, check.critical)
+			}
+			rec := serve(newTestHandler(t, srv), httptest.NewRequest(http.MethodGet, "/health", nil))
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			body := decodeJSON(t, rec.Body)
+			if body["status"] != tt.health {
+				t.Errorf("health = %v, want %s", body["status"], tt.health)
+			}
+			checks := body["checks"].(map[string]interface{})
+			// The built-in checks are reported next to the stubs
+			if _, ok := checks["kv"]; !ok {
+				t.Errorf("checks = %v, want kv among them", checks)
+			}
+			failed := make(map[string]bool)
+			for _, name := range tt.failures {
+				failed[name] = true
+			}
+			for _, check := range tt.checks {
+				name := check.checker.Name()
+				result := checks[name].(map[string]interface{})
+				if want := map[bool]string{true: "failed", false: "ok"}[failed[name]]; result["status"] != want {
+					t.Errorf("%s = %v, want %s", name, result, want)
+				}
+				if errMsg, _ := result["error"].(string); failed[name] && !strings.Contains(errMsg, tt.errorContains) {
+					t.Errorf("%s error = %q, want it to contain %q", name, errMsg, tt.errorContains)
+				}
+				if result["critical"] != check.critical {
+					t.Errorf("%s critical = %v, want %v", name, result["critical"], check.critical)
+				}
+			}
+		})
+	}
+}
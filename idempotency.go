@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxIdempotencyKeyLength caps the length of Idempotency-Key headers
+const maxIdempotencyKeyLength = 255
+
+// idempotencyStore remembers the responses to requests carrying an
+// Idempotency-Key header for ttl, so a client retrying a POST gets the
+// original response instead of having the request processed twice
+type idempotencyStore struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*idempotentResponse
+	lastSweep time.Time
+}
+
+// idempotentResponse is a stored response, or a placeholder while the first
+// request with the key is still being handled
+type idempotentResponse struct {
+	bodyHash [sha256.Size]byte
+	expires  time.Time
+	done     bool
+
+	status int
+	header http.Header
+	body   []byte
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{ttl: ttl, entries: make(map[string]*idempotentResponse)}
+}
+
+// begin looks up key. It returns the stored response when there is one,
+// otherwise it claims the key for the caller, who must then call finish or
+// abandon. A key that is in use for a different body, or still being
+// handled, is a conflict.
+func (s *idempotencyStore) begin(key string, bodyHash [sha256.Size]byte) (stored *idempotentResponse, conflict string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	if entry, ok := s.entries[key]; ok && now.Before(entry.expires) {
+		switch {
+		case entry.bodyHash != bodyHash:
+			return nil, "Idempotency-Key was already used with a different request body"
+		case !entry.done:
+			return nil, "a request with this Idempotency-Key is still being processed"
+		}
+		return entry, ""
+	}
+	s.entries[key] = &idempotentResponse{bodyHash: bodyHash, expires: now.Add(s.ttl)}
+	return nil, ""
+}
+
+// finish stores the response for a key claimed with begin
+func (s *idempotencyStore) finish(key string, status int, header http.Header, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[key]; ok {
+		entry.done = true
+		entry.status, entry.header, entry.body = status, header, body
+	}
+}
+
+// abandon releases a key claimed with begin without storing a response, so
+// a retry is processed again
+func (s *idempotencyStore) abandon(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// sweep drops expired entries, at most once a minute so requests don't pay
+// for a full scan every time. The caller holds mu.
+func (s *idempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// idempotencyMiddleware replays the stored response when a POST repeats an
+// Idempotency-Key seen within the store's ttl, marked with an
+// Idempotent-Replayed header. Reusing a key with a different body, or while
+// the first request is still running, gets a 409. Server errors aren't
+// stored so the client can retry them. Requests without the header, and all
+// requests when ttl is 0, pass straight through.
+func (s *Server) idempotencyMiddleware(store *idempotencyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idempotencyKey := r.Header.Get("Idempotency-Key")
+			if store.ttl == 0 || r.Method != http.MethodPost || idempotencyKey == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(idempotencyKey) > maxIdempotencyKeyLength {
+				s.writeError(w, r, ErrInvalidParameter.WithMessage("Idempotency-Key must be at most "+strconv.Itoa(maxIdempotencyKeyLength)+" bytes long"))
+				return
+			}
+
+			body, ok := s.readBody(w, r)
+			if !ok {
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			// The same key on another endpoint is a different request
+			key := r.URL.Path + "\x00" + idempotencyKey
+			stored, conflict := store.begin(key, sha256.Sum256(body))
+			if conflict != "" {
+				s.writeError(w, r, ErrConflict.WithMessage(conflict))
+				return
+			}
+			if stored != nil {
+				for name, values := range stored.header {
+					if name == "Vary" {
+						w.Header()[name] = append(w.Header()[name], values...)
+						continue
+					}
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(stored.status)
+				w.Write(stored.body)
+				return
+			}
+
+			// Outer middleware such as gzip and CORS already added their Vary
+			// values, and adds them again on a replay
+			outerVary := len(w.Header().Values("Vary"))
+			rec := &statusRecorder{ResponseWriter: w, captureBody: true}
+			completed := false
+			defer func() {
+				// A panic or a server error leaves nothing worth replaying
+				if !completed || rec.Status() >= http.StatusInternalServerError {
+					store.abandon(key)
+				}
+			}()
+			next.ServeHTTP(rec, r)
+			completed = true
+
+			header := rec.Header().Clone()
+			// The replay gets an ID of its own
+			header.Del("X-Request-ID")
+			// The body is captured before gzip compresses it, the replay is
+			// encoded afresh
+			header.Del("Content-Encoding")
+			header.Del("Content-Length")
+			if vary := header.Values("Vary"); len(vary) > outerVary {
+				header["Vary"] = vary[outerVary:]
+			} else {
+				header.Del("Vary")
+			}
+			store.finish(key, rec.Status(), header, rec.body)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingHandler answers with how often it was called and the given status
+func countingHandler(calls *atomic.Int32, status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("X-Call", strconv.Itoa(int(n)))
+		w.WriteHeader(status)
+		w.Write([]byte("call " + strconv.Itoa(int(n))))
+	})
+}
+
+func idempotentPost(key, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	return req
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	srv := newTestServer(t)
+	var calls atomic.Int32
+	handler := srv.idempotencyMiddleware(newIdempotencyStore(time.Hour))(countingHandler(&calls, http.StatusCreated))
+
+	first := serve(handler, idempotentPost("key-1", `{"n":1}`))
+	replay := serve(handler, idempotentPost("key-1", `{"n":1}`))
+	if calls.Load() != 1 {
+		t.Fatalf("handler ran %d times, want once", calls.Load())
+	}
+	if replay.Code != http.StatusCreated || replay.Body.String() != first.Body.String() || replay.Header().Get("X-Call") != "1" {
+		t.Errorf("replay = %d %q, want the first response %d %q", replay.Code, replay.Body, first.Code, first.Body)
+	}
+	if replay.Header().Get("Idempotent-Replayed") != "true" || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("only the replay should be marked Idempotent-Replayed")
+	}
+
+	// Another key, or none at all, is a new request
+	serve(handler, idempotentPost("key-2", `{"n":1}`))
+	serve(handler, httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(`{"n":1}`)))
+	if calls.Load() != 3 {
+		t.Errorf("handler ran %d times, want 3", calls.Load())
+	}
+}
+
+func TestIdempotencyConflict(t *testing.T) {
+	srv := newTestServer(t)
+	var calls atomic.Int32
+	handler := srv.idempotencyMiddleware(newIdempotencyStore(time.Hour))(countingHandler(&calls, http.StatusOK))
+
+	serve(handler, idempotentPost("key-1", `{"n":1}`))
+	assertError(t, serve(handler, idempotentPost("key-1", `{"n":2}`)), http.StatusConflict, "conflict")
+	if calls.Load() != 1 {
+		t.Errorf("handler ran %d times, want once", calls.Load())
+	}
+}
+
+func TestIdempotencySkipsServerErrors(t *testing.T) {
+	srv := newTestServer(t)
+	var calls atomic.Int32
+	handler := srv.idempotencyMiddleware(newIdempotencyStore(time.Hour))(countingHandler(&calls, http.StatusBadGateway))
+
+	serve(handler, idempotentPost("key-1", `{}`))
+	if rec := serve(handler, idempotentPost("key-1", `{}`)); rec.Header().Get("Idempotent-Replayed") != "" || calls.Load() != 2 {
+		t.Errorf("a 502 was replayed, the handler ran %d times", calls.Load())
+	}
+}
+
+func TestIdempotencyExpires(t *testing.T) {
+	srv := newTestServer(t)
+	var calls atomic.Int32
+	handler := srv.idempotencyMiddleware(newIdempotencyStore(10 * time.Millisecond))(countingHandler(&calls, http.StatusOK))
+
+	serve(handler, idempotentPost("key-1", `{}`))
+	time.Sleep(20 * time.Millisecond)
+	// Past the ttl even a different body is fine
+	if rec := serve(handler, idempotentPost("key-1", `{"n":2}`)); rec.Code != http.StatusOK || calls.Load() != 2 {
+		t.Errorf("expired key: status %d, handler ran %d times", rec.Code, calls.Load())
+	}
+}
+
+// Browsers may send the header cross-origin
+func TestIdempotencyKeyCORSPreflight(t *testing.T) {
+	req := httptest.NewRequest(http.MethodOptions, "/post", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type,idempotency-key")
+	rec := serve(newTestHandler(t, newTestServer(t)), req)
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, Idempotency-Key" {
+		t.Errorf("Access-Control-Allow-Headers = %q, want Content-Type, Idempotency-Key", got)
+	}
+}
+
+// Through the full handler the replay is compressed like the first response,
+// the stored body is the one from before gzip
+func TestIdempotencyReplayGzip(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-handler-timeout", "0", "-idempotency-ttl", "1h"))
+	post := func() *httptest.ResponseRecorder {
+		req := idempotentPost("key-1", strings.Repeat(`{"n":1}`, 1000))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Encoding", "gzip")
+		return serve(handler, req)
+	}
+
+	first := post()
+	replay := post()
+	if replay.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatal("the second request was not replayed")
+	}
+	for _, rec := range []*httptest.ResponseRecorder{first, replay} {
+		if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("Content-Encoding = %q, want gzip", got)
+		}
+		zr, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatalf("gzip.NewReader: %v", err)
+		}
+		if body, err := io.ReadAll(zr); err != nil || !json.Valid(body) {
+			t.Errorf("decompressed body = %.40q, %v, want JSON", body, err)
+		}
+	}
+	if got, want := replay.Header().Values("Vary"), first.Header().Values("Vary"); !slices.Equal(got, want) {
+		t.Errorf("replayed Vary = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a parsed path of the simple JSONPath subset -log-body-jsonpath
+// accepts: $ followed by .name, ['name'] and [index] steps, e.g. $.user.id or
+// $.items[0]['display name']. Wildcards, slices and filters aren't supported.
+type jsonPath []jsonPathStep
+
+// jsonPathStep selects an object member by key, or an array item by index
+// when isIndex is set
+type jsonPathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func parseJSONPath(expr string) (jsonPath, error) {
+	rest, ok := strings.CutPrefix(expr, "$")
+	if !ok {
+		return nil, fmt.Errorf("invalid JSON path %q: must start with $", expr)
+	}
+
+	var path jsonPath
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid JSON path %q: empty key", expr)
+			}
+			path = append(path, jsonPathStep{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q: unclosed [", expr)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				path = append(path, jsonPathStep{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q: %q is neither a quoted key nor an index", expr, inner)
+			}
+			path = append(path, jsonPathStep{index: index, isIndex: true})
+		default:
+			return nil, fmt.Errorf("invalid JSON path %q: unexpected %q", expr, rest[0])
+		}
+	}
+	return path, nil
+}
+
+// extract returns the value at the path, nil when it doesn't match. Bodies
+// are first turned into their JSON shape, so form bodies can be addressed as
+// well, e.g. $.name[0].
+func (p jsonPath) extract(body interface{}) interface{} {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil
+	}
+
+	for _, step := range p {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if step.isIndex {
+				return nil
+			}
+			var ok bool
+			if value, ok = v[step.key]; !ok {
+				return nil
+			}
+		case []interface{}:
+			if !step.isIndex || step.index >= len(v) {
+				return nil
+			}
+			value = v[step.index]
+		default:
+			return nil
+		}
+	}
+	return value
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONPathExtract(t *testing.T) {
+	body := map[string]interface{}{
+		"user":  map[string]interface{}{"id": 42.0, "display name": "Ada"},
+		"items": []interface{}{"first", "second"},
+	}
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{"$.user.id", 42.0},
+		{"$.user['display name']", "Ada"},
+		{"$.items[1]", "second"},
+		{"$", body},
+		{"$.user.email", nil},
+		{"$.items[2]", nil},
+		{"$.items.first", nil},
+		{"$.user[0]", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path, err := parseJSONPath(tt.path)
+			if err != nil {
+				t.Fatalf("parseJSONPath: %v", err)
+			}
+			if got := path.extract(body); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extract = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSONPathInvalid(t *testing.T) {
+	for _, expr := range []string{"user.id", "$.", "$.items[", "$.items[-1]", "$.items[x]", "$user"} {
+		if _, err := parseJSONPath(expr); err == nil {
+			t.Errorf("%q was accepted", expr)
+		}
+	}
+}
+
+func TestLogBodyJSONPath(t *testing.T) {
+	tests := []struct {
+		name, body string
+		want       interface{}
+	}{
+		{"matching", `{"user":{"id":"u-1","name":"Ada"}}`, "u-1"},
+		{"not matching", `{"account":{"id":"u-1"}}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, logs := newObservedServer(t, "-log-body-jsonpath", "$.user.id")
+			req := httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			serve(newTestHandler(t, srv), req)
+			if got := loggedRequest(t, logs)["body"]; got != tt.want {
+				t.Errorf("logged body = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
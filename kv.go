@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// maxKVKeyLength caps the length of /kv keys
+const maxKVKeyLength = 256
+
+// kvStore is the in-memory store behind /kv/{key}, it holds JSON documents
+// and lives as long as the server
+type kvStore struct {
+	server *Server
+
+	mu     sync.RWMutex
+	values map[string][]byte
+}
+
+func newKVStore(server *Server) *kvStore {
+	return &kvStore{server: server, values: make(map[string][]byte)}
+}
+
+// Name and Check make the store a HealthChecker, it is healthy as long as it
+// can be read
+func (kv *kvStore) Name() string { return "kv" }
+
+func (kv *kvStore) Check(context.Context) error {
+	kv.mu.RLock()
+	defer kv.mu.RUnlock()
+	return nil
+}
+
+// ServeHTTP handles GET, PUT and DELETE of /kv/{key}
+func (kv *kvStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/kv/")
+	if key == "" || len(key) > maxKVKeyLength {
+		kv.server.writeError(w, r, ErrInvalidParameter.WithMessage("key must be between 1 and 256 bytes long"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		kv.mu.RLock()
+		value, ok := kv.values[key]
+		kv.mu.RUnlock()
+		if !ok {
+			kv.server.writeError(w, r, ErrNotFound)
+			return
+		}
+		// The stored document is sent as is, it was valid JSON when it was put
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(value)
+
+	case http.MethodPut:
+		value, ok := kv.server.readBody(w, r)
+		if !ok {
+			return
+		}
+		if !json.Valid(value) {
+			kv.server.writeError(w, r, ErrInvalidBody.WithMessage("value must be a JSON document"))
+			return
+		}
+
+		kv.mu.Lock()
+		_, existed := kv.values[key]
+		kv.values[key] = value
+		kv.mu.Unlock()
+
+		status := http.StatusCreated
+		if existed {
+			status = http.StatusOK
+		}
+		kv.server.writeResponse(w, r, status, map[string]interface{}{
+			"key":         key,
+			"status_code": status,
+		})
+
+	case http.MethodDelete:
+		kv.mu.Lock()
+		_, existed := kv.values[key]
+		delete(kv.values, key)
+		kv.mu.Unlock()
+		if !existed {
+			kv.server.writeError(w, r, ErrNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		kv.server.writeError(w, r, ErrMethodNotAllowed)
+	}
+}
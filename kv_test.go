@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestKV(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-max-body-bytes", "64"))
+	do := func(method, key, body string) *httptest.ResponseRecorder {
+		return serve(handler, httptest.NewRequest(method, "/kv/"+key, strings.NewReader(body)))
+	}
+
+	assertError(t, do(http.MethodGet, "answer", ""), http.StatusNotFound, "not_found")
+	if rec := do(http.MethodPut, "answer", `{"value":42}`); rec.Code != http.StatusCreated {
+		t.Fatalf("first PUT status = %d, want 201", rec.Code)
+	}
+	if rec := do(http.MethodPut, "answer", `{"value":43}`); rec.Code != http.StatusOK {
+		t.Errorf("second PUT status = %d, want 200", rec.Code)
+	}
+	rec := do(http.MethodGet, "answer", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"value":43}` || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("GET = %d %q %q, want the stored document", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	if rec := do(http.MethodDelete, "answer", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE status = %d, want 204", rec.Code)
+	}
+	assertError(t, do(http.MethodDelete, "answer", ""), http.StatusNotFound, "not_found")
+
+	assertError(t, do(http.MethodPut, "answer", "not json"), http.StatusBadRequest, "invalid_body")
+	assertError(t, do(http.MethodPut, "answer", `"`+strings.Repeat("x", 64)+`"`), http.StatusRequestEntityTooLarge, "body_too_large")
+	assertError(t, do(http.MethodGet, strings.Repeat("k", maxKVKeyLength+1), ""), http.StatusBadRequest, "invalid_parameter")
+}
+
+func TestKVConcurrent(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key-%d", i%5)
+			for j := 0; j < 50; j++ {
+				value := fmt.Sprintf(`{"writer":%d,"n":%d}`, i, j)
+				if rec := serve(handler, httptest.NewRequest(http.MethodPut, "/kv/"+key, strings.NewReader(value))); rec.Code >= 300 {
+					t.Errorf("PUT %s status = %d", key, rec.Code)
+					return
+				}
+				rec := serve(handler, httptest.NewRequest(http.MethodGet, "/kv/"+key, nil))
+				if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), `{"writer":`) {
+					t.Errorf("GET %s = %d %q", key, rec.Code, rec.Body)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
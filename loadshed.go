@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// loadAveragePath is where Linux publishes the load average
+const loadAveragePath = "/proc/loadavg"
+
+// loadSampleInterval is how often the load average is read, the kernel
+// updates it every 5 seconds
+const loadSampleInterval = 5 * time.Second
+
+// loadShedder tracks the 1 minute load average for -shed-load-average.
+// Requests only read the last sample, they never touch /proc themselves.
+type loadShedder struct {
+	threshold float64
+	// load holds the float64 bits of the last sample, 0 until one succeeded
+	load atomic.Uint64
+}
+
+func newLoadShedder(threshold float64) *loadShedder {
+	return &loadShedder{threshold: threshold}
+}
+
+// run samples the load average until ctx is done. A failed sample keeps the
+// previous one, the preflight check has already warned when there is none.
+func (l *loadShedder) run(ctx context.Context) {
+	if l.threshold == 0 {
+		return
+	}
+	ticker := time.NewTicker(loadSampleInterval)
+	defer ticker.Stop()
+	for {
+		if load, err := readLoadAverage(); err == nil {
+			l.load.Store(math.Float64bits(load))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// overloaded reports whether the last sample is above the threshold, and
+// that sample
+func (l *loadShedder) overloaded() (float64, bool) {
+	load := math.Float64frombits(l.load.Load())
+	return load, l.threshold > 0 && load > l.threshold
+}
+
+// readLoadAverage returns the 1 minute load average
+func readLoadAverage() (float64, error) {
+	data, err := os.ReadFile(loadAveragePath)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("%s is empty", loadAveragePath)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// loadShedMiddleware answers 503 with a Retry-After header while the load
+// average is above -shed-load-average, so an overloaded host sheds new work
+// before it slows down every request. Like with -max-concurrent the probes
+// are exempt.
+func (s *Server) loadShedMiddleware(shedder *loadShedder, retryAfter time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			load, overloaded := shedder.overloaded()
+			if !overloaded || s.isProbe(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			addLogFields(r, zap.Float64("load_average", load))
+			w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+			s.writeError(w, r, ErrOverloaded.WithMessage("server load too high"))
+		})
+	}
+}
+
+// retryAfterSeconds formats d for a Retry-After header, in whole seconds
+// rounded up
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
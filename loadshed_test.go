@@ -0,0 +1,43 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLoadShed(t *testing.T) {
+	srv := newTestServer(t)
+	shedder := newLoadShedder(4)
+	handler := srv.loadShedMiddleware(shedder, 1500*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	shedder.load.Store(math.Float64bits(3.5))
+	if rec := serve(handler, httptest.NewRequest(http.MethodGet, "/get", nil)); rec.Code != http.StatusOK {
+		t.Errorf("status under the threshold = %d, want 200", rec.Code)
+	}
+
+	shedder.load.Store(math.Float64bits(8))
+	rec := serve(handler, httptest.NewRequest(http.MethodGet, "/get", nil))
+	retryAfter := rec.Header().Get("Retry-After")
+	assertError(t, rec, http.StatusServiceUnavailable, "overloaded")
+	// Rounded up to whole seconds
+	if retryAfter != "2" {
+		t.Errorf("Retry-After = %q, want 2", retryAfter)
+	}
+	for _, path := range []string{"/health", "/readiness"} {
+		if rec := serve(handler, httptest.NewRequest(http.MethodGet, path, nil)); rec.Code != http.StatusOK {
+			t.Errorf("GET %s while overloaded = %d, want 200", path, rec.Code)
+		}
+	}
+}
+
+// A threshold of 0 never sheds, whatever the load
+func TestLoadShedDisabled(t *testing.T) {
+	shedder := newLoadShedder(0)
+	shedder.load.Store(math.Float64bits(100))
+	if _, overloaded := shedder.overloaded(); overloaded {
+		t.Error("a disabled shedder reports overload")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+)
+
+// logFieldRule adds fields to the request log line of every path starting
+// with prefix
+type logFieldRule struct {
+	prefix string
+	fields map[string]interface{}
+}
+
+// parseLogFields parses the -log-fields JSON object, which maps path prefixes
+// to objects of extra fields, e.g. {"/admin/": {"sensitive": true}}. A
+// trailing * on a prefix is ignored, /admin/* is the same as /admin/.
+func parseLogFields(value string) ([]logFieldRule, error) {
+	var raw map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return nil, fmt.Errorf("invalid log fields: must be a JSON object of path prefixes to objects of fields: %v", err)
+	}
+	rules := make([]logFieldRule, 0, len(raw))
+	for prefix, fields := range raw {
+		if !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("invalid log fields prefix %q: must start with /", prefix)
+		}
+		rules = append(rules, logFieldRule{prefix: strings.TrimSuffix(prefix, "*"), fields: fields})
+	}
+	// Shorter prefixes first, so the more specific rule wins a shared key
+	sort.Slice(rules, func(i, j int) bool {
+		if len(rules[i].prefix) != len(rules[j].prefix) {
+			return len(rules[i].prefix) < len(rules[j].prefix)
+		}
+		return rules[i].prefix < rules[j].prefix
+	})
+	return rules, nil
+}
+
+// logFieldsFor returns the extra fields of every rule matching path, sorted
+// by key
+func logFieldsFor(rules []logFieldRule, path string) []zap.Field {
+	merged := make(map[string]interface{})
+	for _, rule := range rules {
+		if strings.HasPrefix(path, rule.prefix) {
+			for key, value := range rule.fields {
+				merged[key] = value
+			}
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(merged))
+	for key := range merged {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fields := make([]zap.Field, len(keys))
+	for i, key := range keys {
+		fields[i] = zap.Any(key, merged[key])
+	}
+	return fields
+}
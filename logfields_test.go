@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLogFields(t *testing.T) {
+	srv, logs := newObservedServer(t, "-log-fields", `{"/": {"service": "demo", "tier": "public"}, "/status/*": {"sensitive": true, "tier": "internal"}}`)
+	handler := newTestHandler(t, srv)
+
+	tests := []struct {
+		path string
+		want map[string]interface{}
+	}{
+		{"/get", map[string]interface{}{"service": "demo", "tier": "public", "sensitive": nil}},
+		// The longer prefix wins the shared key, the rest merges
+		{"/status/418", map[string]interface{}{"service": "demo", "tier": "internal", "sensitive": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			logs.TakeAll()
+			serve(handler, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			logged := loggedRequest(t, logs)
+			for key, want := range tt.want {
+				if logged[key] != want {
+					t.Errorf("%s = %v, want %v", key, logged[key], want)
+				}
+			}
+			// The standard fields are still there
+			if logged["path"] != tt.path || logged["method"] != http.MethodGet {
+				t.Errorf("path = %v, method = %v, want the request's", logged["path"], logged["method"])
+			}
+		})
+	}
+}
+
+func TestParseLogFieldsInvalid(t *testing.T) {
+	for _, value := range []string{`not json`, `{"/admin": true}`, `{"admin/": {"a": 1}}`} {
+		if rules, err := parseLogFields(value); err == nil {
+			t.Errorf("parseLogFields(%q) = %v, want an error", value, rules)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+func init() {
+	zap.RegisterSink("lumberjack", newLumberjackSink)
+}
+
+// logFileURL describes a log file rotated according to cfg as a zap sink URL,
+// zap opens it together with the other outputs so both share the encoder config
+func logFileURL(file string, cfg *Config) (string, error) {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return "", fmt.Errorf("invalid log file %q: %v", file, err)
+	}
+	query := url.Values{}
+	query.Set("max_size", strconv.Itoa(cfg.LogMaxSize))
+	query.Set("max_backups", strconv.Itoa(cfg.LogMaxBackups))
+	query.Set("max_age", strconv.Itoa(cfg.LogMaxAge))
+	u := url.URL{Scheme: "lumberjack", Path: filepath.ToSlash(path), RawQuery: query.Encode()}
+	return u.String(), nil
+}
+
+// lumberjackSink adapts a rotating file to zap.Sink. Writes go straight to
+// the file, so there is nothing to sync.
+type lumberjackSink struct {
+	*lumberjack.Logger
+}
+
+func (lumberjackSink) Sync() error {
+	return nil
+}
+
+func newLumberjackSink(u *url.URL) (zap.Sink, error) {
+	path := filepath.FromSlash(u.Path)
+	query := u.Query()
+	maxSize, _ := strconv.Atoi(query.Get("max_size"))
+	maxBackups, _ := strconv.Atoi(query.Get("max_backups"))
+	maxAge, _ := strconv.Atoi(query.Get("max_age"))
+
+	// lumberjack only opens the file on the first write, open it now so a bad
+	// path stops the server at startup
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+
+	return lumberjackSink{&lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+		MaxAge:     maxAge,
+	}}, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"os"
+)
+
+// parseLogLevel parses one of the supported log levels
+func parseLogLevel(value string) (zapcore.Level, bool) {
+	level, err := zapcore.ParseLevel(value)
+	if err != nil || level < zapcore.DebugLevel || level > zapcore.ErrorLevel {
+		return zapcore.InfoLevel, false
+	}
+	return level, true
+}
+
+// newLogger builds the zap logger for the configured level and format,
+// writing to stderr or, when set, the rotating log file. Unknown level and
+// format values fall back to info level and JSON output with a warning
+// rather than preventing the server from starting. The level is returned so
+// it can be changed while the server runs.
+func newLogger(cfg *Config) (*zap.Logger, zap.AtomicLevel, error) {
+	level, validLevel := parseLogLevel(cfg.LogLevel)
+
+	invalidFormat := false
+	var zapConfig zap.Config
+	switch cfg.LogFormat {
+	case "console":
+		zapConfig = zap.NewDevelopmentConfig()
+	case "json":
+		zapConfig = zap.NewProductionConfig()
+	default:
+		invalidFormat = true
+		zapConfig = zap.NewProductionConfig()
+	}
+	logLevel := zap.NewAtomicLevelAt(level)
+	zapConfig.Level = logLevel
+	if cfg.LogFile != "" {
+		sink, err := logFileURL(cfg.LogFile, cfg)
+		if err != nil {
+			return nil, zap.AtomicLevel{}, err
+		}
+		zapConfig.OutputPaths = []string{sink}
+	}
+
+	logger, err := zapConfig.Build(zap.WithCaller(false))
+	if err != nil {
+		return nil, zap.AtomicLevel{}, err
+	}
+	if !validLevel {
+		logger.Warn("invalid log level, falling back to info", zap.String("log_level", cfg.LogLevel))
+	}
+	if invalidFormat {
+		logger.Warn("invalid log format, falling back to json", zap.String("log_format", cfg.LogFormat))
+	}
+	return logger, logLevel, nil
+}
+
+// loggerOrFallback returns the configured logger, or the fallback logger
+// with a warning when newLogger fails, so a logging problem never keeps the
+// server from starting
+func loggerOrFallback(cfg *Config) (*zap.Logger, zap.AtomicLevel) {
+	logger, logLevel, err := newLogger(cfg)
+	if err != nil {
+		logger, logLevel = fallbackLogger(cfg)
+		logger.Warn("failed to initialize logger, logging to stderr instead", zap.Error(err))
+	}
+	return logger, logLevel
+}
+
+// fallbackLogger is used when newLogger fails, e.g. because the log file
+// can't be opened. It writes JSON to stderr like the default configuration
+// but can't fail itself: nothing is opened, and when stderr isn't writable
+// either the lines are lost while the server keeps serving.
+func fallbackLogger(cfg *Config) (*zap.Logger, zap.AtomicLevel) {
+	level, _ := parseLogLevel(cfg.LogLevel)
+	logLevel := zap.NewAtomicLevelAt(level)
+	encoder := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	return zap.New(zapcore.NewCore(encoder, zapcore.Lock(os.Stderr), logLevel)), logLevel
+}
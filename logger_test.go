@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// captureStderr returns what f writes to os.Stderr
+func captureStderr(t *testing.T, f func()) []byte {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+	f()
+	w.Close()
+	out, _ := io.ReadAll(r)
+	return out
+}
+
+// A log file that can't be opened falls back to JSON on stderr instead of
+// stopping the server
+func TestLoggerFallback(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig([]string{"-log-file", filepath.Join(file, "server.log"), "-log-level", "warn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := newLogger(cfg); err == nil {
+		t.Fatal("newLogger succeeded with a log file below a regular file")
+	}
+
+	out := captureStderr(t, func() {
+		logger, level := loggerOrFallback(cfg)
+		if level.String() != "warn" {
+			t.Errorf("fallback level = %s, want the configured warn", level)
+		}
+		logger.Info("dropped below the level")
+		logger.Warn("still logged")
+		logger.Sync()
+	})
+	lines := bytes.Split(bytes.TrimSpace(out), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("stderr = %q, want the fallback warning and one line", out)
+	}
+	var first, second map[string]interface{}
+	if json.Unmarshal(lines[0], &first) != nil || json.Unmarshal(lines[1], &second) != nil {
+		t.Fatalf("stderr = %q, want JSON lines", out)
+	}
+	if first["msg"] != "failed to initialize logger, logging to stderr instead" || first["error"] == nil {
+		t.Errorf("first line = %v, want the fallback warning with the error", first)
+	}
+	if second["msg"] != "still logged" {
+		t.Errorf("second line = %v, want the logged warning", second)
+	}
+}
+
+func TestLoggerOrFallbackConfigured(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	cfg, err := loadConfig([]string{"-log-file", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger, _ := loggerOrFallback(cfg)
+	logger.Info("to the file")
+	logger.Sync()
+	if data, _ := os.ReadFile(path); !bytes.Contains(data, []byte("to the file")) {
+		t.Errorf("log file = %q, want the line", data)
+	}
+}
@@ -1,60 +1,75 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
 	"io"
 	"log"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 )
 
-var logger *zap.Logger
-
 // RequestInfo represents the structure for logging request information
 type RequestInfo struct {
-	ID          string            `json:"id"`
-	Timestamp   string            `json:"timestamp"`
-	Method      string            `json:"method"`
-	Path        string            `json:"path"`
-	IP          string            `json:"ip"`
-	Headers     map[string]string `json:"headers"`
-	QueryParams map[string]string `json:"query_params"`
-	Body        interface{}       `json:"body,omitempty"`
-}
-
-// logRequest logs the request details as structured JSON using zap
-func logRequest(r *http.Request, body interface{}) {
-	// Convert headers to map
-	headers := make(map[string]string)
-	for key, values := range r.Header {
-		if len(values) > 0 {
-			headers[key] = values[0] // Take first value if multiple
-		}
-	}
+	ID          string              `json:"id"`
+	Timestamp   string              `json:"timestamp"`
+	Method      string              `json:"method"`
+	Path        string              `json:"path"`
+	IP          string              `json:"ip"`
+	Headers     map[string][]string `json:"headers"`
+	QueryParams map[string][]string `json:"query_params"`
+	Body        interface{}         `json:"body,omitempty"`
+	Status      int                 `json:"status"`
+	Bytes       int                 `json:"bytes"`
+	Duration    time.Duration       `json:"duration"`
+}
 
-	// Convert query parameters to map
-	queryParams := make(map[string]string)
-	for key, values := range r.URL.Query() {
-		if len(values) > 0 {
-			queryParams[key] = values[0] // Take first value if multiple
+// logRequest logs the request and response details as structured JSON using zap,
+// extra fields are appended to the standard ones
+func (s *Server) logRequest(r *http.Request, body interface{}, status, bytes int, start time.Time, extra ...zap.Field) {
+	// Keep every value of repeated headers and query parameters
+	headers := map[string][]string(r.Header.Clone())
+	queryParams := map[string][]string(r.URL.Query())
+
+	// Never let credentials end up in log aggregation
+	for _, name := range s.cfg.RedactHeaders {
+		if values, ok := headers[name]; ok {
+			headers[name] = make([]string, len(values))
+			for i := range values {
+				headers[name][i] = "[REDACTED]"
+			}
 		}
 	}
 
-	currentTime := time.Now()
 	requestInfo := RequestInfo{
-		ID:          fmt.Sprintf("%v", currentTime.UnixNano()),
-		Timestamp:   currentTime.Format(time.RFC3339),
+		ID:          requestID(r),
+		Timestamp:   start.Format(time.RFC3339),
 		Method:      r.Method,
 		Path:        r.URL.Path,
-		IP:          getOriginProxy(r),
+		IP:          s.clientIP(r),
 		Headers:     headers,
 		QueryParams: queryParams,
 		Body:        body,
+		Status:      status,
+		Bytes:       bytes,
+		Duration:    time.Since(start),
 	}
 
-	logger.Info("request received",
+	fields := []zap.Field{
 		zap.String("id", requestInfo.ID),
 		zap.String("timestamp", requestInfo.Timestamp),
 		zap.String("method", requestInfo.Method),
@@ -63,154 +78,442 @@ func logRequest(r *http.Request, body interface{}) {
 		zap.Any("headers", requestInfo.Headers),
 		zap.Any("query_params", requestInfo.QueryParams),
 		zap.Any("body", requestInfo.Body),
-	)
+		zap.Int("status", requestInfo.Status),
+		zap.Int("bytes", requestInfo.Bytes),
+		zap.Duration("duration", requestInfo.Duration),
+	}
+	s.logger.Info("request received", append(fields, extra...)...)
+}
+
+// methodHandler wraps fn so that it only runs for the given method, any other
+// method gets a 405 response listing the permitted ones in the Allow header.
+// GET handlers answer HEAD as well, net/http drops the body they write.
+func (s *Server) methodHandler(method string, fn http.HandlerFunc) http.HandlerFunc {
+	allow := allowedMethods(method)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method && !(method == http.MethodGet && r.Method == http.MethodHead) {
+			w.Header().Set("Allow", allow)
+			s.writeError(w, r, ErrMethodNotAllowed)
+			return
+		}
+		fn(w, r)
+	}
+}
+
+// applyDelay sleeps for the duration given in the ?delay= query parameter,
+// capped at the configured maximum, to help test client timeouts. It returns
+// false when the handler must stop: the delay was invalid and a 400 has been
+// written, the request deadline passed and a 503 has been written, or the
+// client went away while waiting.
+func (s *Server) applyDelay(w http.ResponseWriter, r *http.Request) bool {
+	value := r.URL.Query().Get("delay")
+	if value == "" {
+		return true
+	}
+	delay, err := time.ParseDuration(value)
+	if err != nil || delay < 0 {
+		s.writeError(w, r, ErrInvalidParameter.WithMessage("delay must be a non-negative duration such as 500ms"))
+		return false
+	}
+	if delay > s.cfg.MaxDelay {
+		delay = s.cfg.MaxDelay
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+			s.writeError(w, r, ErrDeadlineExceeded)
+		}
+		// Otherwise nobody is left to receive a response
+		return false
+	}
 }
 
 // handleGet handles GET requests
-func handleGet(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET method
-	if r.Method != http.MethodGet {
-		buildErrorResponse(w, r)
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	if !s.applyDelay(w, r) {
 		return
 	}
 
-	// Log the GET request (no body)
-	logRequest(r, nil)
-
 	// Send response
-	w.Header().Set("Content-Type", "application/json")
-	response := map[string]interface{}{
-		"ip":          getOriginProxy(r),
-		"path":        r.URL.Path,
-		"status_code": http.StatusOK,
-		"message":     "GET request received successfully",
+	response := ReflectedResponse{
+		IP:          s.clientIP(r),
+		Path:        r.URL.Path,
+		StatusCode:  http.StatusOK,
+		Message:     "GET request received successfully",
+		QueryParams: multiValues(r.URL.Query()),
 	}
 
-	if len(r.URL.Query()) > 0 {
-		response["query_params"] = r.URL.Query()
+	s.writeResponse(w, r, http.StatusOK, response)
+}
+
+// handlePost handles POST requests
+func (s *Server) handlePost(w http.ResponseWriter, r *http.Request) {
+	// Forms with file uploads are summarized, unless only JSON is acceptable
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" && !s.cfg.StrictJSON && s.postSchema == nil {
+		s.handleMultipart(w, r)
+		return
 	}
+	s.handleWithBody(w, r, s.postSchema)
+}
 
-	json.NewEncoder(w).Encode(response)
+// handlePut handles PUT requests
+func (s *Server) handlePut(w http.ResponseWriter, r *http.Request) {
+	s.handleWithBody(w, r, nil)
 }
 
-// handlePost handles POST requests
-func handlePost(w http.ResponseWriter, r *http.Request) {
-	// Only allow POST method
-	if r.Method != http.MethodPost {
-		buildErrorResponse(w, r)
+// handlePatch handles PATCH requests
+func (s *Server) handlePatch(w http.ResponseWriter, r *http.Request) {
+	s.handleWithBody(w, r, nil)
+}
+
+// handleDelete handles DELETE requests
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	// Send response
+	response := ReflectedResponse{
+		IP:         s.clientIP(r),
+		Path:       r.URL.Path,
+		StatusCode: http.StatusOK,
+		Message:    "DELETE request received successfully",
+	}
+
+	s.writeResponse(w, r, http.StatusOK, response)
+}
+
+// handleWithBody reads, logs and reflects the body of POST, PUT and PATCH
+// requests. When schema is given the body must be JSON matching it.
+func (s *Server) handleWithBody(w http.ResponseWriter, r *http.Request, schema *jsonschema.Schema) {
+	// In strict mode only JSON bodies are accepted, charset and other parameters are fine
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if s.cfg.StrictJSON && mediaType != "application/json" {
+		s.writeError(w, r, ErrUnsupportedMediaType.WithMessage("Content-Type must be application/json"))
 		return
 	}
-	// Read the request body
-	bodyBytes, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
+
+	// Read the request body, refusing anything over the configured limit
+	bodyBytes, ok := s.readBody(w, r)
+	if !ok {
 		return
 	}
-	defer r.Body.Close()
 
-	// Try to parse as JSON, fallback to string if not valid JSON
+	// A schema can only be satisfied by JSON, whatever the content type says,
+	// and strict mode doesn't settle for a string either
+	parser := bodyParserFor(mediaType)
+	if schema != nil || s.cfg.StrictJSON {
+		parser = jsonParser{strict: true}
+	}
+
 	var bodyData interface{}
 	if len(bodyBytes) > 0 {
-		if err := json.Unmarshal(bodyBytes, &bodyData); err != nil {
-			// If not valid JSON, store as string
-			bodyData = string(bodyBytes)
+		// The parser reads the body again from what was already read
+		r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		var err error
+		if bodyData, err = parser.Parse(r); err != nil {
+			s.writeError(w, r, ErrInvalidBody.WithMessage(err.Error()))
+			return
 		}
 	}
 
-	// Log the POST request with body
-	logRequest(r, bodyData)
+	// Attach the body to the request log line
+	setLogBody(r, bodyData)
 
-	// Send response
-	w.Header().Set("Content-Type", "application/json")
-	response := map[string]interface{}{
-		"ip":           getOriginProxy(r),
-		"path":         r.URL.Path,
-		"status_code":  http.StatusOK,
-		"message":      "POST request received successfully",
-		"content_type": r.Header.Get("Content-Type"),
+	if schema != nil {
+		if err := schema.Validate(bodyData); err != nil {
+			s.writeSchemaErrors(w, r, err)
+			return
+		}
 	}
 
-	if len(bodyBytes) > 0 {
-		response["body_length"] = len(bodyBytes)
-		response["body"] = string(bodyBytes)
+	if !s.applyDelay(w, r) {
+		return
+	}
+
+	if s.cfg.responseTemplate != nil {
+		s.writeTemplateResponse(w, r, bodyBytes, bodyData)
+		return
+	}
+
+	// Send response
+	response := ReflectedResponse{
+		IP:          s.clientIP(r),
+		Path:        r.URL.Path,
+		StatusCode:  http.StatusOK,
+		Message:     r.Method + " request received successfully",
+		ContentType: r.Header.Get("Content-Type"),
+		BodyLength:  len(bodyBytes),
+		Body:        string(bodyBytes),
+	}
+	if form, ok := bodyData.(url.Values); ok {
+		response.Form = multiValues(form)
 	}
 
-	json.NewEncoder(w).Encode(response)
+	s.writeReflectedResponse(w, r, http.StatusOK, response, len(bodyBytes))
 }
 
-func buildErrorResponse(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusMethodNotAllowed)
-	response := map[string]interface{}{
-		"ip":          getOriginProxy(r),
-		"error":       "Method Not Allowed",
-		"status_code": http.StatusMethodNotAllowed,
+// handleRoot greets clients at / and answers 404 for any path no other route matched
+func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		s.writeError(w, r, ErrNotFound)
+		return
+	}
+	response := ReflectedResponse{
+		Message:    "Welcome to the Go Web Server",
+		Hint:       "Try /get, /post, /put, /patch, /delete, or /health endpoints",
+		StatusCode: http.StatusOK,
 	}
-	json.NewEncoder(w).Encode(response)
+	s.writeResponse(w, r, http.StatusOK, response)
 }
 
-// healthCheck handles health check endpoint
-func healthCheck(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// healthCheck handles health check endpoint. It runs the registered
+// subsystem checks and fails with 503 when a critical one fails.
+func (s *Server) healthCheck(w http.ResponseWriter, r *http.Request) {
+	health, checks := s.runHealthChecks(r.Context(), s.cfg.HealthCheckTimeout)
+	status := http.StatusOK
+	if health == "unhealthy" {
+		status = http.StatusServiceUnavailable
+	}
+
 	response := map[string]any{
-		"ip":          getOriginProxy(r),
-		"healthy":     "true",
-		"time":        time.Now().Format(time.RFC3339),
-		"status_code": http.StatusOK,
+		"ip":              s.clientIP(r),
+		"healthy":         strconv.FormatBool(status == http.StatusOK),
+		"status":          health,
+		"checks":          checks,
+		"time":            time.Now().Format(time.RFC3339),
+		"requests_served": s.requestsServed.Load(),
+		"in_flight":       s.inFlight.Load(),
+		"uptime_seconds":  int64(time.Since(s.startTime).Seconds()),
+		"status_code":     status,
 	}
-	json.NewEncoder(w).Encode(response)
+	s.writeResponse(w, r, status, response)
 }
 
-func getOriginProxy(r *http.Request) string {
-	ip := r.Header.Get("X-Origin-Proxy")
-	if ip == "" {
-		ip = r.RemoteAddr
+// readinessCheck handles the readiness probe, unlike healthCheck it fails
+// with 503 until startup completes and again while the server drains
+func (s *Server) readinessCheck(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	state := "ready"
+	if !s.ready.Load() {
+		status = http.StatusServiceUnavailable
+		state = "not ready"
 	}
-	return ip
+
+	response := map[string]any{
+		"ip":          s.clientIP(r),
+		"ready":       status == http.StatusOK,
+		"status":      state,
+		"time":        time.Now().Format(time.RFC3339),
+		"status_code": status,
+	}
+	s.writeResponse(w, r, status, response)
 }
 
 func main() {
-	var err error
-	logger, err = zap.NewProduction(zap.WithCaller(false))
+	cfg, err := loadConfig(os.Args[1:])
 	if err != nil {
-		log.Fatalf("Failed to initialize logger: %v", err)
+		log.Fatalf("Invalid configuration: %v", err)
 	}
+
+	logger, logLevel := loggerOrFallback(cfg)
 	defer logger.Sync()
+	for _, warning := range cfg.Warnings {
+		logger.Warn(warning)
+	}
+	srv := newServer(cfg, logger, logLevel)
+
+	// Stop on Ctrl+C locally and on SIGTERM from docker stop or an orchestrator,
+	// /admin/shutdown takes the same path by cancelling the context
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, requestShutdown := context.WithCancel(ctx)
+	defer requestShutdown()
 
-	// Create a new HTTP server mux
-	mux := http.NewServeMux()
-
-	// Register handlers
-	mux.HandleFunc("/get", handleGet)
-	mux.HandleFunc("/post", handlePost)
-	mux.HandleFunc("/health", healthCheck)
-
-	// Default handler for undefined routes
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		logRequest(r, nil)
-		w.Header().Set("Content-Type", "application/json")
-		response := map[string]string{
-			"message": "Welcome to the Go Web Server",
-			"hint":    "Try /get, /post, or /health endpoints",
+	if cfg.AccessLogFormat == "combined" {
+		var closeAccessLog func()
+		if srv.accessLog, closeAccessLog, err = openAccessLog(cfg); err != nil {
+			logger.Fatal("failed to open access log", zap.String("path", cfg.AccessLogFile), zap.Error(err))
 		}
-		json.NewEncoder(w).Encode(response)
-	})
+		defer closeAccessLog()
+	}
+
+	if cfg.PostSchema != "" {
+		if srv.postSchema, err = loadSchema(cfg.PostSchema); err != nil {
+			logger.Fatal("invalid post schema", zap.String("path", cfg.PostSchema), zap.Error(err))
+		}
+	}
+
+	tracing := tracingEnabled()
+	if tracing {
+		shutdownTracing, err := initTracing(ctx)
+		if err != nil {
+			logger.Fatal("failed to initialize tracing", zap.Error(err))
+		}
+		defer func() {
+			// Flush the spans of the last requests, the signal context is gone by now
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(flushCtx); err != nil {
+				logger.Warn("failed to flush traces", zap.Error(err))
+			}
+		}()
+	}
+
+	handler, table := srv.newHandler(ctx, requestShutdown, tracing)
+	var adminHandler http.Handler
+	var adminTable []route
+	if cfg.AdminAddr != "" {
+		adminHandler, adminTable = srv.newAdminHandler()
+	}
 
 	// Server configuration
 	server := &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		// OPTIONS * goes through the middleware like any other request
+		DisableGeneralOptionsHandler: true,
+	}
+	server.RegisterOnShutdown(func() {
+		close(srv.shuttingDown)
+	})
+	// Forces a new connection per request, e.g. to reproduce connection churn
+	// in load tests. net/http adds the Connection: close header itself.
+	server.SetKeepAlivesEnabled(!cfg.DisableKeepAlive)
+
+	// HTTPS negotiates HTTP/2 on its own, plain HTTP only speaks it with -h2c
+	scheme, protocol := "http", "HTTP/1.1"
+	if cfg.TLSCert != "" {
+		if server.TLSConfig, err = newTLSConfig(cfg.TLSCert, cfg.TLSKey); err != nil {
+			logger.Fatal("invalid TLS configuration", zap.Error(err))
+		}
+		scheme, protocol = "https", "HTTP/1.1, HTTP/2"
+		if cfg.H2C {
+			logger.Warn("h2c only applies to plain HTTP, HTTPS serves HTTP/2 anyway")
+		}
+	} else if cfg.H2C {
+		server.Handler = h2c.NewHandler(server.Handler, &http2.Server{IdleTimeout: cfg.IdleTimeout})
+		protocol = "HTTP/1.1, h2c"
 	}
 
 	// Start server
-	fmt.Println("Starting server on http://localhost:8080")
+	fmt.Printf("Starting server on %s (%s)\n", cfg.Addr, scheme)
+	if cfg.BasePath != "" {
+		fmt.Printf("Routes are served under %s\n", cfg.BasePath)
+	}
 	fmt.Println("Available endpoints:")
-	fmt.Println("  GET  /get")
-	fmt.Println("  POST /post")
-	fmt.Println("  GET  /health")
-	fmt.Println("  GET  / (default)")
-	fmt.Println("\nServer logs will appear below\n")
-
-	logger.Info("server started", zap.String("address", server.Addr))
-	log.Fatal(server.ListenAndServe())
+	printRoutes(os.Stdout, table)
+	if cfg.AdminAddr != "" {
+		fmt.Printf("\nAdmin endpoints on %s:\n", cfg.AdminAddr)
+		printRoutes(os.Stdout, adminTable)
+	}
+	fmt.Print("\nServer logs will appear below\n\n")
+
+	// Bind before serving so a busy port fails right away and readiness is only
+	// reported once connections can actually be accepted
+	listener, adminListener, err := srv.preflight()
+	if err != nil {
+		logger.Fatal("server not started", zap.String("address", server.Addr), zap.Error(err))
+	}
+	listener = limitConnections(listener, cfg.MaxConnections)
+
+	serverErr := make(chan error, 2)
+	// The profiling endpoints get no write timeout, recording a profile takes
+	// as long as ?seconds= asks for
+	var adminServer *http.Server
+	if adminListener != nil {
+		adminServer = &http.Server{
+			Handler:           adminHandler,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		}
+		go func() {
+			logger.Info("admin server started", zap.String("address", cfg.AdminAddr), zap.Bool("pprof", cfg.EnablePprof), zap.Bool("pprof_auth", cfg.EnablePprof && !cfg.PprofNoAuth))
+			serverErr <- adminServer.Serve(adminListener)
+		}()
+	}
+	go func() {
+		logger.Info("server started",
+			zap.String("address", server.Addr),
+			zap.String("scheme", scheme),
+			zap.String("protocol", protocol),
+			zap.Duration("read_header_timeout", server.ReadHeaderTimeout),
+			zap.Duration("read_timeout", server.ReadTimeout),
+			zap.Duration("write_timeout", server.WriteTimeout),
+			zap.Duration("idle_timeout", server.IdleTimeout),
+			zap.Int("max_header_bytes", server.MaxHeaderBytes),
+			zap.Bool("keep_alive", !cfg.DisableKeepAlive),
+			zap.Int("max_connections", cfg.MaxConnections),
+		)
+		if server.TLSConfig != nil {
+			// The certificate is already in TLSConfig
+			serverErr <- server.ServeTLS(listener, "", "")
+		} else {
+			serverErr <- server.Serve(listener)
+		}
+	}()
+	srv.ready.Store(true)
+
+	select {
+	case err := <-serverErr:
+		// Serve only returns before Shutdown when it fails
+		logger.Fatal("server failed", zap.Error(err))
+	case <-ctx.Done():
+	}
+	stop()
+
+	srv.shutdown(server, adminServer)
+	logger.Info("server stopped")
+}
+
+// limitConnections caps the open connections of listener at max, 0 leaves
+// it unlimited. Connections over the limit wait in the kernel's backlog
+// until one closes, idle keep-alive connections count as well.
+func limitConnections(listener net.Listener, max int) net.Listener {
+	if max <= 0 {
+		return listener
+	}
+	return netutil.LimitListener(listener, max)
+}
+
+// shutdown stops the servers after the shutdown signal: readiness fails
+// first, then the servers stop accepting connections and drain within
+// -shutdown-timeout. adminServer is nil without -admin-addr.
+func (s *Server) shutdown(server, adminServer *http.Server) {
+	s.ready.Store(false)
+	// Keep serving while the orchestrator notices the failing readiness probe
+	// and takes the instance out of the load balancer. Signals are back to
+	// their default handling, a second one ends the process right away.
+	if s.cfg.PreshutdownDelay > 0 {
+		s.logger.Info("readiness cleared, waiting before shutdown", zap.Duration("delay", s.cfg.PreshutdownDelay))
+		time.Sleep(s.cfg.PreshutdownDelay)
+	}
+	s.logger.Info("server shutting down", zap.Duration("timeout", s.cfg.ShutdownTimeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		s.logger.Warn("graceful shutdown timed out, forcing close", zap.Error(err))
+		server.Close()
+	}
+	// The admin server goes last, so probes and metrics see the main one
+	// drain. It gets a timeout of its own, the main server may have used up
+	// shutdownCtx.
+	if adminServer != nil {
+		adminCtx, cancelAdmin := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+		defer cancelAdmin()
+		if err := adminServer.Shutdown(adminCtx); err != nil {
+			s.logger.Warn("graceful shutdown of the admin server timed out, forcing close", zap.Error(err))
+			adminServer.Close()
+		}
+	}
+	s.waitBackground(shutdownCtx)
 }
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMethodNotAllowedSetsAllow(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	tests := []struct {
+		method, path, allow string
+	}{
+		{http.MethodPost, "/get", "GET, HEAD"},
+		{http.MethodGet, "/post", "POST"},
+		{http.MethodDelete, "/put", "PUT"},
+		{http.MethodPost, "/kv/key", "GET, HEAD, PUT, DELETE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := serve(handler, httptest.NewRequest(tt.method, tt.path, nil))
+			assertError(t, rec, http.StatusMethodNotAllowed, "method_not_allowed")
+			if got := rec.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("Allow = %q, want %q", got, tt.allow)
+			}
+		})
+	}
+}
+
+// loggedRequest returns the fields of the only request log line
+func loggedRequest(t *testing.T, logs *observer.ObservedLogs) map[string]interface{} {
+	t.Helper()
+	entries := logs.FilterMessage("request received").All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d request log lines, want 1", len(entries))
+	}
+	return entries[0].ContextMap()
+}
+
+func TestLogKeepsRepeatedValues(t *testing.T) {
+	srv, logs := newObservedServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/get?tag=a&tag=b", nil)
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Accept", "text/plain")
+	serve(newTestHandler(t, srv), req)
+
+	fields := loggedRequest(t, logs)
+	if got := fields["query_params"].(map[string][]string)["tag"]; !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("logged tag = %v, want [a b]", got)
+	}
+	if got := fields["headers"].(map[string][]string)["Accept"]; len(got) != 2 {
+		t.Errorf("logged Accept = %v, want both values", got)
+	}
+}
+
+func TestLogRedactsHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		redacted string
+	}{
+		{"default", nil, "Authorization"},
+		{"configured, any case", []string{"-redact-headers", "x-secret"}, "X-Secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, logs := newObservedServer(t, tt.args...)
+			req := httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(`{}`))
+			req.Header.Set(tt.redacted, "secret")
+			req.Header.Set("X-Visible", "shown")
+			serve(newTestHandler(t, srv), req)
+
+			headers := loggedRequest(t, logs)["headers"].(map[string][]string)
+			if got := headers[tt.redacted]; !slices.Equal(got, []string{"[REDACTED]"}) {
+				t.Errorf("logged %s = %v, want [REDACTED]", tt.redacted, got)
+			}
+			if got := headers["X-Visible"]; !slices.Equal(got, []string{"shown"}) {
+				t.Errorf("logged X-Visible = %v, want it untouched", got)
+			}
+			if req.Header.Get(tt.redacted) != "secret" {
+				t.Errorf("redaction changed the request itself")
+			}
+		})
+	}
+}
+
+func TestCatchAll(t *testing.T) {
+	srv, logs := newObservedServer(t)
+	handler := newTestHandler(t, srv)
+
+	rec := serve(handler, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET / status = %d, want 200", rec.Code)
+	}
+	if body := decodeJSON(t, rec.Body); body["message"] != "Welcome to the Go Web Server" {
+		t.Errorf("GET / body = %v, want the welcome message", body)
+	}
+	if got := loggedRequest(t, logs)["status"]; got != int64(http.StatusOK) {
+		t.Errorf("logged status = %v, want 200", got)
+	}
+
+	logs.TakeAll()
+	rec = serve(handler, httptest.NewRequest(http.MethodGet, "/does-not-exist", nil))
+	assertError(t, rec, http.StatusNotFound, "not_found")
+	if got := loggedRequest(t, logs)["status"]; got != int64(http.StatusNotFound) {
+		t.Errorf("logged status = %v, want 404", got)
+	}
+}
+
+func TestMaxHeaderBytes(t *testing.T) {
+	srv := newTestServer(t, "-max-header-bytes", "1024")
+	ts := httptest.NewUnstartedServer(newTestHandler(t, srv))
+	ts.Config.MaxHeaderBytes = srv.cfg.MaxHeaderBytes
+	ts.Start()
+	defer ts.Close()
+
+	get := func(headerBytes int) int {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/get", nil)
+		req.Header.Set("X-Padding", strings.Repeat("x", headerBytes))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /get: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := get(100); status != http.StatusOK {
+		t.Errorf("small headers: status = %d, want 200", status)
+	}
+	// net/http allows a few KiB of slack on top of the limit
+	if status := get(16 << 10); status != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("oversized headers: status = %d, want 431", status)
+	}
+}
+
+func TestMaxHeaderBytesConfig(t *testing.T) {
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxHeaderBytes != 1<<20 {
+		t.Errorf("default max header bytes = %d, want 1 MiB", cfg.MaxHeaderBytes)
+	}
+	if _, err := loadConfig([]string{"-max-header-bytes", "0"}); err == nil {
+		t.Error("-max-header-bytes 0 was accepted")
+	}
+}
+
+// The handler wrapped the way main does with -h2c answers HTTP/2 with prior
+// knowledge over plain TCP, and HTTP/1.1 as before
+func TestH2C(t *testing.T) {
+	srv := newTestServer(t, "-h2c")
+	ts := httptest.NewServer(h2c.NewHandler(newTestHandler(t, srv), &http2.Server{IdleTimeout: srv.cfg.IdleTimeout}))
+	defer ts.Close()
+
+	h2cClient := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	for _, tt := range []struct {
+		client *http.Client
+		proto  string
+	}{
+		{h2cClient, "HTTP/2.0"},
+		{http.DefaultClient, "HTTP/1.1"},
+	} {
+		resp, err := tt.client.Get(ts.URL + "/echo")
+		if err != nil {
+			t.Fatalf("GET /echo over %s: %v", tt.proto, err)
+		}
+		body := decodeJSON(t, resp.Body)
+		resp.Body.Close()
+		if resp.Proto != tt.proto || body["proto"] != tt.proto {
+			t.Errorf("response over %s, server saw %v, want %s", resp.Proto, body["proto"], tt.proto)
+		}
+	}
+}
+
+func TestHeadMirrorsGet(t *testing.T) {
+	ts := startTestServer(t, newTestServer(t))
+
+	get, err := http.Get(ts.URL + "/get")
+	if err != nil {
+		t.Fatalf("GET /get: %v", err)
+	}
+	getBody, _ := io.ReadAll(get.Body)
+	get.Body.Close()
+
+	head, err := http.Head(ts.URL + "/get")
+	if err != nil {
+		t.Fatalf("HEAD /get: %v", err)
+	}
+	headBody, _ := io.ReadAll(head.Body)
+	head.Body.Close()
+
+	if head.StatusCode != http.StatusOK || len(headBody) != 0 {
+		t.Errorf("HEAD /get = %d with %d body bytes, want an empty 200", head.StatusCode, len(headBody))
+	}
+	if got := head.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if head.Header.Get("X-Request-ID") == "" {
+		t.Errorf("X-Request-ID is missing")
+	}
+	if head.ContentLength != int64(len(getBody)) {
+		t.Errorf("Content-Length = %d, want the %d bytes of the GET body", head.ContentLength, len(getBody))
+	}
+}
+
+// During -preshutdown-delay readiness fails but requests, on open connections
+// too, are still served. Shutdown only starts once the delay is over.
+func TestPreshutdownDelay(t *testing.T) {
+	srv, logs := newObservedServer(t, "-preshutdown-delay", "300ms")
+	ts := httptest.NewServer(newTestHandler(t, srv))
+	defer ts.Close()
+	client := ts.Client()
+	get := func(path string) (int, bool) {
+		var reused bool
+		trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) { reused = info.Reused }}
+		req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodGet, ts.URL+path, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, reused
+	}
+	if status, _ := get("/readiness"); status != http.StatusOK {
+		t.Fatalf("GET /readiness before shutdown = %d, want 200", status)
+	}
+
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		srv.shutdown(ts.Config, nil)
+		close(done)
+	}()
+	for logs.FilterMessage("readiness cleared, waiting before shutdown").Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if status, _ := get("/readiness"); status != http.StatusServiceUnavailable {
+		t.Errorf("GET /readiness during the delay = %d, want 503", status)
+	}
+	if status, reused := get("/get"); status != http.StatusOK || !reused {
+		t.Errorf("GET /get during the delay = %d on a reused connection %v, want 200 on the open one", status, reused)
+	}
+
+	<-done
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("shutdown finished after %v, before the delay was over", elapsed)
+	}
+	if logs.FilterMessage("server shutting down").Len() != 1 {
+		t.Error("the shutdown phase wasn't logged")
+	}
+}
+
+// Connections over -max-connections aren't served until an open one closes,
+// idle keep-alive connections hold their slot
+func TestLimitConnections(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: newTestHandler(t, newTestServer(t))}
+	go server.Serve(limitConnections(listener, 2))
+	defer server.Close()
+	url := "http://" + listener.Addr().String() + "/get"
+
+	get := func(transport *http.Transport, timeout time.Duration) error {
+		client := &http.Client{Transport: transport, Timeout: timeout}
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, resp.Body)
+		return resp.Body.Close()
+	}
+	first, second, third := &http.Transport{}, &http.Transport{}, &http.Transport{}
+	for _, transport := range []*http.Transport{first, second} {
+		if err := get(transport, 5*time.Second); err != nil {
+			t.Fatalf("GET within the limit: %v", err)
+		}
+	}
+	defer second.CloseIdleConnections()
+
+	if err := get(third, 200*time.Millisecond); err == nil {
+		t.Fatal("a third connection was served while two were open")
+	}
+	first.CloseIdleConnections()
+	if err := get(third, 5*time.Second); err != nil {
+		t.Errorf("GET once a connection closed: %v", err)
+	}
+	third.CloseIdleConnections()
+}
+
+func TestLimitConnectionsUnlimited(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if limitConnections(listener, 0) != listener {
+		t.Error("-max-connections 0 wrapped the listener")
+	}
+}
+
+// A main server that drains for the whole timeout doesn't cut the in-flight
+// requests of the admin server short
+func TestShutdownAdminServer(t *testing.T) {
+	srv, logs := newObservedServer(t, "-shutdown-timeout", "200ms")
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	main := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	defer main.Close()
+	defer close(release)
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer admin.Close()
+
+	go http.Get(main.URL)
+	<-started
+	// The admin request starts while the main server is still draining and
+	// runs past its timeout
+	adminDone := make(chan error, 1)
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		resp, err := http.Get(admin.URL)
+		if err == nil {
+			_, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		adminDone <- err
+	}()
+	srv.shutdown(main.Config, admin.Config)
+	if err := <-adminDone; err != nil {
+		t.Errorf("admin request during shutdown: %v", err)
+	}
+	if logs.FilterMessage("graceful shutdown of the admin server timed out, forcing close").Len() != 0 {
+		t.Error("the admin server was closed without draining")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "path", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "path"})
+)
+
+// metricsMiddleware records request counts and latencies. Requests are
+// labeled with the mux pattern they matched rather than the raw path so
+// /status/503 and /status/404 don't each create a new time series. Routes in
+// excluded, e.g. /metrics itself, are not counted. It sits outside the
+// limiters and recoverMiddleware, so their rejections and recovered panics
+// are counted too.
+func metricsMiddleware(mux *http.ServeMux, excluded []string) func(http.Handler) http.Handler {
+	skip := make(map[string]bool)
+	for _, path := range excluded {
+		skip[path] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, pattern := mux.Handler(r)
+			if skip[pattern] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			// Deferred so a panic that gets past recoverMiddleware, such as
+			// http.ErrAbortHandler, still counts, as a 500
+			defer func() {
+				status := rec.Status()
+				p := recover()
+				if p != nil {
+					status = http.StatusInternalServerError
+				}
+				method := metricsMethod(r.Method)
+				httpRequestsTotal.WithLabelValues(method, pattern, strconv.Itoa(status)).Inc()
+				httpRequestDuration.WithLabelValues(method, pattern).Observe(time.Since(start).Seconds())
+				if p != nil {
+					panic(p)
+				}
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// metricsMethod folds non-standard methods into one label value, /echo accepts
+// anything and each made up method would otherwise become its own series
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetricsCountRequests(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	counter := httpRequestsTotal.WithLabelValues(http.MethodGet, "/status/", "418")
+	before := testutil.ToFloat64(counter)
+
+	serve(handler, httptest.NewRequest(http.MethodGet, "/status/418", nil))
+	serve(handler, httptest.NewRequest(http.MethodGet, "/status/418", nil))
+
+	if got := testutil.ToFloat64(counter) - before; got != 2 {
+		t.Errorf("http_requests_total{path=/status/,status=418} grew by %v, want 2", got)
+	}
+}
+
+// /metrics is excluded by default, scrapes don't count themselves
+func TestMetricsExcludesItself(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	counter := httpRequestsTotal.WithLabelValues(http.MethodGet, "/metrics", "200")
+	before := testutil.ToFloat64(counter)
+
+	rec := serve(handler, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics status = %d", rec.Code)
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 0 {
+		t.Errorf("scraping /metrics counted %v requests, want 0", got)
+	}
+}
+
+// Requests the limiters turn away are counted with their status
+func TestMetricsCountRejections(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-rate-limit", "1", "-rate-burst", "1"))
+	counter := httpRequestsTotal.WithLabelValues(http.MethodGet, "/get", "429")
+	before := testutil.ToFloat64(counter)
+
+	serve(handler, httptest.NewRequest(http.MethodGet, "/get", nil))
+	if rec := serve(handler, httptest.NewRequest(http.MethodGet, "/get", nil)); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request = %d, want 429", rec.Code)
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("http_requests_total{path=/get,status=429} grew by %v, want 1", got)
+	}
+}
+
+// Panics count as 500s, whether recoverMiddleware answered them or not
+func TestMetricsCountPanics(t *testing.T) {
+	srv := newTestServer(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics-panic", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("abort") {
+			panic(http.ErrAbortHandler)
+		}
+		panic("boom")
+	})
+	handler := metricsMiddleware(mux, nil)(srv.recoverMiddleware(mux))
+	counter := httpRequestsTotal.WithLabelValues(http.MethodGet, "/metrics-panic", "500")
+	before := testutil.ToFloat64(counter)
+
+	assertError(t, serve(handler, httptest.NewRequest(http.MethodGet, "/metrics-panic", nil)), http.StatusInternalServerError, "internal_error")
+	func() {
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Errorf("recovered %v, want the panic to go on", p)
+			}
+		}()
+		serve(handler, httptest.NewRequest(http.MethodGet, "/metrics-panic?abort=1", nil))
+	}()
+	if got := testutil.ToFloat64(counter) - before; got != 2 {
+		t.Errorf("http_requests_total{path=/metrics-panic,status=500} grew by %v, want 2", got)
+	}
+}
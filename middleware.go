@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type requestIDKey struct{}
+
+// maxRequestIDLength bounds client supplied request IDs so they can't bloat log lines
+const maxRequestIDLength = 128
+
+// requestID returns the ID of the request: the one resolved by
+// requestIDMiddleware, the client's X-Request-ID when it is usable, or a new one
+func requestID(r *http.Request) string {
+	if id, ok := r.Context().Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	if id := r.Header.Get("X-Request-ID"); validRequestID(id) {
+		return id
+	}
+	return timestampRequestID()
+}
+
+// validRequestID reports whether id is short and only made of printable ASCII
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestLogger returns the logger annotated with the request ID
+func (s *Server) requestLogger(r *http.Request) *zap.Logger {
+	return s.logger.With(zap.String("request_id", requestID(r)))
+}
+
+// requestIDMiddleware resolves the request ID once, the client's X-Request-ID
+// when it is usable or a new one from s.newRequestID, echoes it back in the
+// X-Request-ID response header and makes it available to everything downstream
+func (s *Server) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = s.newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// logEntry collects details that handlers contribute to the request log line.
+// It is locked because a handler cut off by the handler timeout keeps running
+// in its own goroutine while the line is written.
+type logEntry struct {
+	mu     sync.Mutex
+	body   interface{}
+	fields []zap.Field
+}
+
+type logEntryKey struct{}
+
+// setLogBody records the parsed request body so the logging middleware can include it
+func setLogBody(r *http.Request, body interface{}) {
+	if entry, ok := r.Context().Value(logEntryKey{}).(*logEntry); ok {
+		entry.mu.Lock()
+		entry.body = body
+		entry.mu.Unlock()
+	}
+}
+
+// addLogFields adds extra fields to the request log line
+func addLogFields(r *http.Request, fields ...zap.Field) {
+	if entry, ok := r.Context().Value(logEntryKey{}).(*logEntry); ok {
+		entry.mu.Lock()
+		entry.fields = append(entry.fields, fields...)
+		entry.mu.Unlock()
+	}
+}
+
+// chain wraps h in the given middleware. The first one is the outermost: it
+// sees the request first and the response last, so
+//
+//	chain(h, a, b, c)
+//
+// is a(b(c(h))), the request passes a, b and c in that order before reaching h.
+func chain(h http.Handler, middleware ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// truncatedMarker ends a logged body that was cut at -max-log-body-bytes
+const truncatedMarker = "...[truncated]"
+
+// logRequestBody prepares a parsed request body for the log line: nil when
+// request bodies aren't logged, only the value at -log-body-jsonpath when
+// that is set, and cut short when it encodes to more than the cap
+func (s *Server) logRequestBody(body interface{}) interface{} {
+	if !s.cfg.LogRequestBody {
+		return nil
+	}
+	if body != nil && s.cfg.LogBodyJSONPath != nil {
+		body = s.cfg.LogBodyJSONPath.extract(body)
+	}
+	if body == nil || s.cfg.MaxLogBodyBytes == 0 {
+		return body
+	}
+	data, err := json.Marshal(body)
+	if err != nil || len(data) <= s.cfg.MaxLogBodyBytes {
+		return body
+	}
+	return string(data[:s.cfg.MaxLogBodyBytes]) + truncatedMarker
+}
+
+// logResponseBody turns the captured start of a response into a log value,
+// JSON responses stay JSON unless they had to be truncated
+func logResponseBody(header http.Header, body []byte, truncated bool) interface{} {
+	switch {
+	case len(body) == 0:
+		return nil
+	case header.Get("Content-Encoding") != "":
+		// Compressed bytes mean nothing in a log line
+		return "[" + header.Get("Content-Encoding") + " encoded]"
+	case truncated:
+		return string(body) + truncatedMarker
+	case json.Valid(body):
+		return json.RawMessage(body)
+	}
+	return string(body)
+}
+
+// statusRecorder wraps an http.ResponseWriter to remember the status code and
+// the number of bytes written to the client. With captureBody set it also
+// keeps the first bodyLimit bytes of the response, all of them when 0.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+
+	captureBody bool
+	bodyLimit   int
+	body        []byte
+	truncated   bool
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	// Only the first final status reaches the client, net/http ignores the rest.
+	// Informational 1xx responses can precede it and aren't the outcome.
+	if rec.status == 0 && (status >= 200 || status == http.StatusSwitchingProtocols) {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	// net/http sends an implicit 200 when Write is called before WriteHeader
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	if rec.captureBody {
+		rec.capture(b[:n])
+	}
+	return n, err
+}
+
+func (rec *statusRecorder) capture(b []byte) {
+	if rec.bodyLimit > 0 && len(rec.body)+len(b) > rec.bodyLimit {
+		b = b[:max(rec.bodyLimit-len(rec.body), 0)]
+		rec.truncated = true
+	}
+	rec.body = append(rec.body, b...)
+}
+
+// Status returns the recorded status code, a handler that never wrote
+// anything still results in a 200 from net/http
+func (rec *statusRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// Flush lets streaming handlers flush through the recorder
+func (rec *statusRecorder) Flush() {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets /ws take over the connection through the recorder, which then
+// records the protocol switch as the status
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(rec.ResponseWriter).Hijack()
+	if err == nil && rec.status == 0 {
+		rec.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// loggingMiddleware logs every request once the handler has run, including the
+// response status and size, so no handler has to remember to log on its own.
+// In paired mode the request is also logged as it comes in.
+func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &logEntry{}
+		r = r.WithContext(context.WithValue(r.Context(), logEntryKey{}, entry))
+		rec := &statusRecorder{ResponseWriter: w, captureBody: s.cfg.LogResponseBody, bodyLimit: s.cfg.MaxLogBodyBytes}
+		if s.cfg.LogMode == "paired" {
+			s.logger.Info("request started",
+				zap.String("id", requestID(r)),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.String("ip", s.clientIP(r)),
+			)
+		}
+
+		next.ServeHTTP(rec, r)
+
+		s.requestsServed.Add(1)
+		entry.mu.Lock()
+		body := entry.body
+		fields := append([]zap.Field(nil), entry.fields...)
+		entry.mu.Unlock()
+		fields = append(fields, logFieldsFor(s.cfg.LogFields, r.URL.Path)...)
+		if s.cfg.LogResponseBody {
+			fields = append(fields, zap.Reflect("response_body", logResponseBody(rec.Header(), rec.body, rec.truncated)))
+		}
+		s.logRequest(r, s.logRequestBody(body), rec.Status(), rec.bytes, start, fields...)
+		if s.accessLog != nil {
+			if _, err := s.accessLog.Write([]byte(s.combinedLogLine(r, rec.Status(), rec.bytes, start))); err != nil {
+				s.logger.Warn("failed to write access log", zap.Error(err))
+			}
+		}
+	})
+}
+
+// recoverMiddleware turns a panicking handler into a 500 JSON response instead
+// of a dropped connection. The panic and stack trace are logged, never sent to the client.
+// A handler that already started its response can't be answered with a 500
+// anymore, the connection is aborted instead so the client doesn't take the
+// partial response for a complete one.
+func (s *Server) recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// ErrAbortHandler is net/http's way of aborting a response on purpose
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			s.requestLogger(r).Error("handler panicked",
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.Any("panic", err),
+				zap.ByteString("stack", debug.Stack()),
+				zap.Bool("response_started", rec.status != 0),
+			)
+			if rec.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			s.writeError(w, r, ErrInternal)
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// corsPolicy holds the CORS allowlist, it can be replaced while requests are
+// being served
+type corsPolicy struct {
+	origins atomic.Pointer[corsOrigins]
+}
+
+type corsOrigins struct {
+	allowAny bool
+	allowed  map[string]bool
+}
+
+func newCORSPolicy(allowedOrigins []string) *corsPolicy {
+	policy := &corsPolicy{}
+	policy.set(allowedOrigins)
+	return policy
+}
+
+// set replaces the allowlist, "*" allows every origin
+func (p *corsPolicy) set(allowedOrigins []string) {
+	origins := &corsOrigins{allowed: make(map[string]bool)}
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			origins.allowAny = true
+		}
+		origins.allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+	p.origins.Store(origins)
+}
+
+func (p *corsPolicy) current() (allowAny bool, allowed map[string]bool) {
+	origins := p.origins.Load()
+	return origins.allowAny, origins.allowed
+}
+
+// corsAllowedHeaders are the request headers cross-origin clients may send,
+// the ones the server acts on
+var corsAllowedHeaders = []string{"Content-Type", "Authorization", "X-Request-ID", "X-Api-Key", "Idempotency-Key"}
+
+// corsAllowHeaders is the Access-Control-Allow-Headers value of a response:
+// the allowed subset of the headers a preflight asks for, or all of them
+func corsAllowHeaders(r *http.Request) string {
+	requested := r.Header.Values("Access-Control-Request-Headers")
+	if len(requested) == 0 {
+		return strings.Join(corsAllowedHeaders, ", ")
+	}
+	var allowed []string
+	for _, value := range requested {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			for _, candidate := range corsAllowedHeaders {
+				if http.CanonicalHeaderKey(candidate) == name && !slices.Contains(allowed, candidate) {
+					allowed = append(allowed, candidate)
+				}
+			}
+		}
+	}
+	return strings.Join(allowed, ", ")
+}
+
+// corsMiddleware adds CORS headers for origins on the allowlist and answers
+// preflight requests directly. An origin that isn't allowed gets no CORS
+// headers at all, which makes the browser block the response.
+func corsMiddleware(policy *corsPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			allowAny, allowed := policy.current()
+
+			// The response depends on Origin unless every origin is treated the same
+			if !allowAny {
+				w.Header().Add("Vary", "Origin")
+			}
+			if r.Method == http.MethodOptions {
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+			}
+			if allowAny || allowed[origin] {
+				if allowAny {
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+				} else {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+				}
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+				// Headers the browser didn't ask about are left out, so the
+				// preflight fails for the ones the server doesn't accept
+				if allowHeaders := corsAllowHeaders(r); allowHeaders != "" {
+					w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+				}
+				w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+			}
+
+			// Preflight requests never reach the handlers
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	srv, logs := newObservedServer(t)
+	handler := srv.recoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["boom"]++
+	}))
+
+	rec := serve(handler, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if strings.Contains(rec.Body.String(), "goroutine") || strings.Contains(rec.Body.String(), "nil map") {
+		t.Errorf("response leaks the panic: %s", rec.Body)
+	}
+	assertError(t, rec, http.StatusInternalServerError, "internal_error")
+
+	entries := logs.FilterMessage("handler panicked").All()
+	if len(entries) != 1 || entries[0].Level != zapcore.ErrorLevel {
+		t.Fatalf("logged %v, want one error entry", entries)
+	}
+	if stack, _ := entries[0].ContextMap()["stack"].(string); !strings.Contains(stack, "goroutine") {
+		t.Errorf("stack not logged: %q", stack)
+	}
+}
+
+// A panic after the response started aborts the connection instead of
+// appending an error to the partial body
+func TestRecoverMiddlewareAfterWrite(t *testing.T) {
+	srv := newTestServer(t)
+	handler := srv.recoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("late")
+	}))
+
+	rec := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if err := recover(); err != http.ErrAbortHandler {
+				t.Errorf("recovered %v, want http.ErrAbortHandler", err)
+			}
+		}()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	}()
+	if rec.Code != http.StatusOK || rec.Body.String() != "partial" {
+		t.Errorf("response = %d %q, want the partial 200 untouched", rec.Code, rec.Body)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	srv, logs := newObservedServer(t)
+	handler := newTestHandler(t, srv)
+
+	tests := []struct {
+		name, incoming string
+		honored        bool
+	}{
+		{"honors incoming", "client-id-42", true},
+		{"generates when absent", "", false},
+		{"replaces unusable", "has spaces in it", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.TakeAll()
+			req := httptest.NewRequest(http.MethodGet, "/get", nil)
+			if tt.incoming != "" {
+				req.Header.Set("X-Request-ID", tt.incoming)
+			}
+			rec := serve(handler, req)
+
+			id := rec.Header().Get("X-Request-ID")
+			if tt.honored && id != tt.incoming {
+				t.Errorf("X-Request-ID = %q, want the incoming %q", id, tt.incoming)
+			}
+			if !tt.honored && (id == "" || id == tt.incoming) {
+				t.Errorf("X-Request-ID = %q, want a generated ID", id)
+			}
+			entries := logs.FilterMessage("request received").All()
+			if len(entries) != 1 || entries[0].ContextMap()["id"] != id {
+				t.Errorf("request log %v, want id %q", entries, id)
+			}
+		})
+	}
+}
+
+func TestRequestIDHelper(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "abc")
+	if got := requestID(req); got != "abc" {
+		t.Errorf("requestID = %q, want the header's abc", got)
+	}
+	req.Header.Del("X-Request-ID")
+	if got := requestID(req); got == "" {
+		t.Errorf("requestID without a header is empty")
+	}
+}
+
+func TestCORS(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-cors-origins", "https://app.example.com"))
+
+	t.Run("preflight", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/post", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		rec := serve(handler, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want 204", rec.Code)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+			t.Errorf("Access-Control-Allow-Origin = %q", got)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(got, http.MethodPost) {
+			t.Errorf("Access-Control-Allow-Methods = %q, want POST in it", got)
+		}
+		if rec.Header().Get("Access-Control-Allow-Headers") == "" {
+			t.Errorf("Access-Control-Allow-Headers is missing")
+		}
+	})
+
+	tests := []struct {
+		origin string
+		allow  string
+	}{
+		{"https://app.example.com", "https://app.example.com"},
+		{"https://evil.example.com", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/get", nil)
+			req.Header.Set("Origin", tt.origin)
+			rec := serve(handler, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.allow {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allow)
+			}
+			if tt.allow == "" && rec.Header().Get("Access-Control-Allow-Methods") != "" {
+				t.Errorf("disallowed origin got CORS headers: %v", rec.Header())
+			}
+		})
+	}
+
+	// The default allows any origin
+	req := httptest.NewRequest(http.MethodGet, "/get", nil)
+	req.Header.Set("Origin", "https://anywhere.example.com")
+	rec := serve(newTestHandler(t, newTestServer(t)), req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("default Access-Control-Allow-Origin = %q, want *", got)
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	tag := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Order", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	handler := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Order", "handler")
+	}), tag("a"), tag("b"), tag("c"))
+
+	rec := serve(handler, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := strings.Join(rec.Header().Values("X-Order"), ","); got != "a,b,c,handler" {
+		t.Errorf("X-Order = %s, want a,b,c,handler", got)
+	}
+}
+
+// Route middleware only applies to its route: credentials protect /post but
+// not /health
+func TestRouteMiddleware(t *testing.T) {
+	t.Setenv("API_KEYS", "secret")
+	handler := newTestHandler(t, newTestServer(t))
+
+	assertError(t, serve(handler, httptest.NewRequest(http.MethodPost, "/post", strings.NewReader("{}"))), http.StatusUnauthorized, "unauthorized")
+	if rec := serve(handler, httptest.NewRequest(http.MethodGet, "/health", nil)); rec.Code != http.StatusOK {
+		t.Errorf("GET /health status = %d, want 200", rec.Code)
+	}
+}
+
+func TestLogModes(t *testing.T) {
+	for _, mode := range []string{"single", "paired"} {
+		t.Run(mode, func(t *testing.T) {
+			srv, logs := newObservedServer(t, "-log-mode", mode)
+			serve(newTestHandler(t, srv), httptest.NewRequest(http.MethodGet, "/status/404?a=1", nil))
+
+			// The completed line has the request and the response side
+			logged := loggedRequest(t, logs)
+			for _, key := range []string{"id", "timestamp", "method", "path", "ip", "headers", "query_params", "duration"} {
+				if _, ok := logged[key]; !ok {
+					t.Errorf("request line lacks %s: %v", key, logged)
+				}
+			}
+			if logged["status"] != int64(http.StatusNotFound) || logged["bytes"].(int64) == 0 {
+				t.Errorf("status = %v, bytes = %v, want the 404 and its size", logged["status"], logged["bytes"])
+			}
+
+			started := logs.FilterMessage("request started").All()
+			if mode == "single" {
+				if len(started) != 0 {
+					t.Errorf("single mode logged %d request started lines", len(started))
+				}
+				return
+			}
+			if len(started) != 1 || started[0].ContextMap()["id"] != logged["id"] || started[0].ContextMap()["path"] != "/status/404" {
+				t.Errorf("request started lines = %v, want one for the same request", started)
+			}
+		})
+	}
+}
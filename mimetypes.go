@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// parseMIMETypes turns the .ext=type entries of -mime-type into a map from
+// lower case extension to media type
+func parseMIMETypes(values []string) (map[string]string, error) {
+	types := make(map[string]string, len(values))
+	for _, value := range values {
+		ext, mediaType, ok := strings.Cut(value, "=")
+		ext, mediaType = strings.ToLower(strings.TrimSpace(ext)), strings.TrimSpace(mediaType)
+		if !ok || len(ext) < 2 || !strings.HasPrefix(ext, ".") || strings.Contains(ext[1:], ".") {
+			return nil, fmt.Errorf("invalid mime type %q: must be .ext=type", value)
+		}
+		if _, _, err := mime.ParseMediaType(mediaType); err != nil {
+			return nil, fmt.Errorf("invalid mime type %q: %v", value, err)
+		}
+		types[ext] = mediaType
+	}
+	return types, nil
+}
+
+// setMIMEType sets the Content-Type configured with -mime-type for the
+// extension of name, if there is one. http.ServeContent keeps a Content-Type
+// that is already set, so this overrides detection for static files, mock
+// files and downloads of this server alone.
+func (s *Server) setMIMEType(w http.ResponseWriter, name string) {
+	if mediaType, ok := s.cfg.MIMETypes[strings.ToLower(path.Ext(name))]; ok {
+		w.Header().Set("Content-Type", mediaType)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNoSniff(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-nosniff"))
+	for _, target := range []string{"/get", "/nope", "/status/500"} {
+		if got := serve(handler, httptest.NewRequest(http.MethodGet, target, nil)).Header().Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("GET %s: X-Content-Type-Options = %q, want nosniff", target, got)
+		}
+	}
+
+	// Off by default
+	handler = newTestHandler(t, newTestServer(t))
+	if got := serve(handler, httptest.NewRequest(http.MethodGet, "/get", nil)).Header().Get("X-Content-Type-Options"); got != "" {
+		t.Errorf("by default X-Content-Type-Options = %q, want none", got)
+	}
+}
+
+// A configured type replaces the detected one of static files, mock files
+// and downloads, for that server only
+func TestMIMETypeOverride(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"data.mimetest", "page.html"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("<html></html>"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	args := []string{"-static-dir", dir, "-download-dir", dir, "-mock-file", "/mimetest=" + filepath.Join(dir, "data.mimetest")}
+	handler := newTestHandler(t, newTestServer(t, append(args, "-mime-type", ".MimeTest=application/x-mime-test")...))
+
+	for target, want := range map[string]string{
+		"/static/data.mimetest":   "application/x-mime-test",
+		"/download/data.mimetest": "application/x-mime-test",
+		"/mimetest":               "application/x-mime-test",
+		"/static/page.html":       "text/html; charset=utf-8",
+	} {
+		if got := serve(handler, httptest.NewRequest(http.MethodGet, target, nil)).Header().Get("Content-Type"); got != want {
+			t.Errorf("GET %s: Content-Type = %q, want %q", target, got, want)
+		}
+	}
+
+	// A server without the mapping side by side still detects the type
+	other := newTestHandler(t, newTestServer(t, args...))
+	if got := serve(other, httptest.NewRequest(http.MethodGet, "/static/data.mimetest", nil)).Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("other server: Content-Type = %q, want the detected text/html", got)
+	}
+}
+
+func TestParseMIMETypesInvalid(t *testing.T) {
+	for _, value := range []string{"json=application/json", ".=text/plain", ".a.b=text/plain", ".x=not a type", ".x"} {
+		if types, err := parseMIMETypes([]string{value}); err == nil {
+			t.Errorf("parseMIMETypes(%q) = %v, want an error", value, types)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// parseMockFiles turns the path=file entries of -mock-file into a map from
+// URL path to file
+func parseMockFiles(values []string) (map[string]string, error) {
+	files := make(map[string]string, len(values))
+	for _, value := range values {
+		path, file, ok := strings.Cut(value, "=")
+		path, file = strings.TrimSpace(path), strings.TrimSpace(file)
+		if !ok || !strings.HasPrefix(path, "/") || file == "" {
+			return nil, fmt.Errorf("invalid mock file %q: must be /path=file", value)
+		}
+		if _, dup := files[path]; dup {
+			return nil, fmt.Errorf("mock file path %q is mapped twice", path)
+		}
+		files[path] = file
+	}
+	return files, nil
+}
+
+// mockFileHandler answers with the contents of file. The file is opened on
+// every request so edits show up without a restart, and http.ServeContent
+// infers the Content-Type from the extension, unless -mime-type names one,
+// and handles HEAD and ranges. A file that has gone missing is a 500, the
+// mock is misconfigured.
+func (s *Server) mockFileHandler(file string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, err := os.Open(file)
+		if err != nil {
+			s.logMockError(r, file, err)
+			s.writeError(w, r, ErrInternal)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err == nil && info.IsDir() {
+			err = fmt.Errorf("%s is a directory", file)
+		}
+		if err != nil {
+			s.logMockError(r, file, err)
+			s.writeError(w, r, ErrInternal)
+			return
+		}
+		s.setMIMEType(w, info.Name())
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	})
+}
+
+func (s *Server) logMockError(r *http.Request, file string, err error) {
+	msg := "failed to read mock file"
+	if errors.Is(err, fs.ErrNotExist) {
+		msg = "mock file not found"
+	}
+	s.requestLogger(r).Error(msg, zap.String("file", file), zap.Error(err))
+}
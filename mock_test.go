@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "user.json")
+	if err := os.WriteFile(path, []byte(`{"name":"ada"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	handler := newTestHandler(t, newTestServer(t, "-mock-file", "/users/1="+path))
+
+	rec := serve(handler, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"name":"ada"}` {
+		t.Errorf("GET /users/1 = %d %q, want the file contents", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+
+	// Edits show up on the next request
+	if err := os.WriteFile(path, []byte(`{"name":"grace"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(handler, httptest.NewRequest(http.MethodGet, "/users/1", nil)); rec.Body.String() != `{"name":"grace"}` {
+		t.Errorf("after an edit GET /users/1 = %q, want the new contents", rec.Body)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	assertError(t, serve(handler, httptest.NewRequest(http.MethodGet, "/users/1", nil)), http.StatusInternalServerError, "internal_error")
+}
+
+func TestParseMockFilesInvalid(t *testing.T) {
+	for _, values := range [][]string{
+		{"users.json"},
+		{"users=users.json"},
+		{"/users="},
+		{"/users=a.json", "/users=b.json"},
+	} {
+		if files, err := parseMockFiles(values); err == nil {
+			t.Errorf("parseMockFiles(%q) = %v, want an error", values, files)
+		}
+	}
+}
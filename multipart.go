@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// multipartMemory is how much of a multipart body is kept in memory, larger
+// files are spooled to temporary files until the request is done
+const multipartMemory = 8 << 20
+
+// uploadedFile describes a file of a multipart request without its contents
+type uploadedFile struct {
+	Field       string `json:"field" xml:"field"`
+	Filename    string `json:"filename" xml:"filename"`
+	Size        int64  `json:"size" xml:"size"`
+	ContentType string `json:"content_type" xml:"content_type"`
+}
+
+// MultipartResponse summarizes a multipart/form-data request
+type MultipartResponse struct {
+	XMLName     xml.Name       `json:"-" xml:"response"`
+	ContentType string         `json:"content_type" xml:"content_type"`
+	Fields      multiValues    `json:"fields" xml:"fields"`
+	Files       []uploadedFile `json:"files" xml:"files>file"`
+	IP          string         `json:"ip" xml:"ip"`
+	Message     string         `json:"message" xml:"message"`
+	Path        string         `json:"path" xml:"path"`
+	StatusCode  int            `json:"status_code" xml:"status_code"`
+}
+
+// handleMultipart summarizes a multipart/form-data request: the form fields
+// with their values and the metadata of every uploaded file. The log line
+// only gets the field names and file metadata.
+func (s *Server) handleMultipart(w http.ResponseWriter, r *http.Request) {
+	// The limit covers the whole body, all fields and files together
+	r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes)
+	start := time.Now()
+	err := r.ParseMultipartForm(min(s.cfg.MaxBodyBytes, multipartMemory))
+	addServerTiming(r, "read", time.Since(start))
+	if err != nil {
+		// A gone client or a passed deadline is answered like any body read
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) || r.Context().Err() != nil {
+			s.handleBodyError(w, r, err)
+			return
+		}
+		s.writeError(w, r, ErrInvalidBody.WithMessage("invalid multipart body: "+err.Error()))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	fieldNames := make([]string, 0, len(r.MultipartForm.Value))
+	for name := range r.MultipartForm.Value {
+		fieldNames = append(fieldNames, name)
+	}
+	sort.Strings(fieldNames)
+
+	files := []uploadedFile{}
+	for field, headers := range r.MultipartForm.File {
+		for _, header := range headers {
+			files = append(files, uploadedFile{
+				Field:       field,
+				Filename:    header.Filename,
+				Size:        header.Size,
+				ContentType: header.Header.Get("Content-Type"),
+			})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Field != files[j].Field {
+			return files[i].Field < files[j].Field
+		}
+		return files[i].Filename < files[j].Filename
+	})
+
+	setLogBody(r, map[string]interface{}{
+		"fields": fieldNames,
+		"files":  files,
+	})
+
+	if !s.applyDelay(w, r) {
+		return
+	}
+
+	response := MultipartResponse{
+		IP:          s.clientIP(r),
+		Path:        r.URL.Path,
+		StatusCode:  http.StatusOK,
+		Message:     r.Method + " request received successfully",
+		ContentType: r.Header.Get("Content-Type"),
+		Fields:      multiValues(r.MultipartForm.Value),
+		Files:       files,
+	}
+	s.writeResponse(w, r, http.StatusOK, response)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// multipartBody builds a form with the field name=ada and a small text file
+func multipartBody(t *testing.T) (*bytes.Buffer, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("name", "ada")
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="upload"; filename="notes.txt"`)
+	header.Set("Content-Type", "text/plain")
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("hello, file"))
+	mw.Close()
+	return &buf, mw.FormDataContentType()
+}
+
+func TestMultipart(t *testing.T) {
+	srv, logs := newObservedServer(t)
+	body, contentType := multipartBody(t)
+	req := httptest.NewRequest(http.MethodPost, "/post", body)
+	req.Header.Set("Content-Type", contentType)
+	rec := serve(newTestHandler(t, srv), req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200, body %s", rec.Code, rec.Body)
+	}
+
+	response := decodeJSON(t, rec.Body)
+	if got := response["fields"].(map[string]interface{})["name"]; len(got.([]interface{})) != 1 || got.([]interface{})[0] != "ada" {
+		t.Errorf("fields.name = %v, want [ada]", got)
+	}
+	files := response["files"].([]interface{})
+	if len(files) != 1 {
+		t.Fatalf("files = %v, want one", files)
+	}
+	file := files[0].(map[string]interface{})
+	if file["field"] != "upload" || file["filename"] != "notes.txt" || file["size"] != float64(len("hello, file")) || file["content_type"] != "text/plain" {
+		t.Errorf("file = %v", file)
+	}
+
+	// The log gets the field names and file metadata, never the contents
+	logged, err := json.Marshal(loggedRequest(t, logs)["body"])
+	if err != nil {
+		t.Fatalf("encoding the logged body: %v", err)
+	}
+	if strings.Contains(string(logged), "hello, file") || strings.Contains(string(logged), "ada") {
+		t.Errorf("logged body leaks the form contents: %s", logged)
+	}
+	if !strings.Contains(string(logged), `"name"`) || !strings.Contains(string(logged), "notes.txt") {
+		t.Errorf("logged body = %s, want the field name and file metadata", logged)
+	}
+}
+
+func TestMultipartBodyLimit(t *testing.T) {
+	body, contentType := multipartBody(t)
+	req := httptest.NewRequest(http.MethodPost, "/post", body)
+	req.Header.Set("Content-Type", contentType)
+	rec := serve(newTestHandler(t, newTestServer(t, "-max-body-bytes", "64")), req)
+	assertError(t, rec, http.StatusRequestEntityTooLarge, "body_too_large")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// allowedMethods is the Allow header of a route answering method, GET
+// routes answer HEAD as well
+func allowedMethods(method string) string {
+	if method == http.MethodGet {
+		return "GET, HEAD"
+	}
+	return method
+}
+
+// optionsMiddleware answers OPTIONS requests for routes of a single method
+// with a 204 listing the methods in the Allow header, without running the
+// handler. OPTIONS * lists every method the server has a route for. Routes
+// that accept any method, e.g. /echo or the proxy, handle OPTIONS themselves,
+// and CORS preflights have been answered by corsMiddleware already.
+func (s *Server) optionsMiddleware(mux *http.ServeMux, table []route) func(http.Handler) http.Handler {
+	root := s.routePath("/")
+	allow := make(map[string]string, len(table))
+	var all []string
+	for _, rt := range table {
+		if rt.method == "" {
+			continue
+		}
+		allow[rt.path] = allowedMethods(rt.method)
+		for _, method := range strings.Split(allow[rt.path], ", ") {
+			if !slices.Contains(all, method) {
+				all = append(all, method)
+			}
+		}
+	}
+	all = append(all, http.MethodOptions)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.RequestURI == "*" {
+				w.Header().Set("Allow", strings.Join(all, ", "))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			_, pattern := mux.Handler(r)
+			methods, ok := allow[pattern]
+			// The root pattern catches every unknown path, those stay a 404
+			if !ok || pattern == root && r.URL.Path != root {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Allow", methods)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
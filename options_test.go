@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOptions(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	tests := []struct {
+		target string
+		allow  string
+	}{
+		{"/get", "GET, HEAD"},
+		{"/post", "POST"},
+		{"/delete", "DELETE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec := serve(handler, httptest.NewRequest(http.MethodOptions, tt.target, nil))
+			if rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+				t.Errorf("status = %d with body %q, want an empty 204", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("Allow = %q, want %q", got, tt.allow)
+			}
+		})
+	}
+
+	t.Run("*", func(t *testing.T) {
+		rec := serve(handler, httptest.NewRequest(http.MethodOptions, "*", nil))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("OPTIONS * = %d, want 204", rec.Code)
+		}
+		allow := strings.Split(rec.Header().Get("Allow"), ", ")
+		for _, method := range []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"} {
+			if !slices.Contains(allow, method) {
+				t.Errorf("Allow = %q, want %s in it", allow, method)
+			}
+		}
+	})
+
+	// Unknown paths don't get to pretend they exist
+	t.Run("unknown", func(t *testing.T) {
+		assertError(t, serve(handler, httptest.NewRequest(http.MethodOptions, "/nope", nil)), http.StatusNotFound, "not_found")
+	})
+}
+
+// The probes and /metrics serve what OPTIONS advertises for them
+func TestOptionsAdminRoutes(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	for _, target := range []string{"/health", "/readiness", "/metrics"} {
+		t.Run(target, func(t *testing.T) {
+			rec := serve(handler, httptest.NewRequest(http.MethodOptions, target, nil))
+			if got := rec.Header().Get("Allow"); got != "GET, HEAD" {
+				t.Errorf("OPTIONS Allow = %q, want GET, HEAD", got)
+			}
+			if rec := serve(handler, httptest.NewRequest(http.MethodHead, target, nil)); rec.Code != http.StatusOK {
+				t.Errorf("HEAD = %d, want 200", rec.Code)
+			}
+			rec = serve(handler, httptest.NewRequest(http.MethodPost, target, nil))
+			allow := rec.Header().Get("Allow")
+			assertError(t, rec, http.StatusMethodNotAllowed, "method_not_allowed")
+			if allow != "GET, HEAD" {
+				t.Errorf("POST Allow = %q, want GET, HEAD", allow)
+			}
+		})
+	}
+}
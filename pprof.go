@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// pprofPrefix is where the profiling endpoints live, the path net/http/pprof
+// expects
+const pprofPrefix = "/debug/pprof/"
+
+// pprofHandler serves the net/http/pprof endpoints below /debug/pprof/.
+// They reveal a lot about the process, so unless -pprof-no-auth is set they
+// require the admin token like /admin/shutdown.
+func (s *Server) pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pprofPrefix, pprof.Index)
+	mux.HandleFunc(pprofPrefix+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(pprofPrefix+"profile", pprof.Profile)
+	mux.HandleFunc(pprofPrefix+"symbol", pprof.Symbol)
+	mux.HandleFunc(pprofPrefix+"trace", pprof.Trace)
+	if s.cfg.PprofNoAuth {
+		return mux
+	}
+	return s.adminTokenMiddleware(s.cfg.AdminToken)(mux)
+}
+
+// adminTokenMiddleware only lets requests through that carry the admin token
+// as "Authorization: Bearer <token>", others get a 403
+func (s *Server) adminTokenMiddleware(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !hasAdminToken(r, token) {
+				s.writeError(w, r, ErrForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasAdminToken reports whether r carries token as a bearer token
+func hasAdminToken(r *http.Request, token string) bool {
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && secureCompare(given, token)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPprof(t *testing.T) {
+	get := func(handler http.Handler, target, token string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return serve(handler, req).Code
+	}
+
+	t.Run("off", func(t *testing.T) {
+		handler := newTestHandler(t, newTestServer(t))
+		if status := get(handler, "/debug/pprof/", ""); status != http.StatusNotFound {
+			t.Errorf("GET /debug/pprof/ = %d, want 404", status)
+		}
+	})
+
+	t.Run("admin token", func(t *testing.T) {
+		t.Setenv("ADMIN_TOKEN", "s3cret")
+		handler := newTestHandler(t, newTestServer(t, "-enable-pprof"))
+		for target, want := range map[string]int{"/debug/pprof/": http.StatusOK, "/debug/pprof/cmdline": http.StatusOK} {
+			if status := get(handler, target, "s3cret"); status != want {
+				t.Errorf("GET %s with the token = %d, want %d", target, status, want)
+			}
+		}
+		if status := get(handler, "/debug/pprof/", ""); status != http.StatusForbidden {
+			t.Errorf("GET /debug/pprof/ without the token = %d, want 403", status)
+		}
+		if status := get(handler, "/debug/pprof/", "guess"); status != http.StatusForbidden {
+			t.Errorf("GET /debug/pprof/ with a wrong token = %d, want 403", status)
+		}
+	})
+
+	t.Run("no auth", func(t *testing.T) {
+		handler := newTestHandler(t, newTestServer(t, "-enable-pprof", "-pprof-no-auth"))
+		if status := get(handler, "/debug/pprof/", ""); status != http.StatusOK {
+			t.Errorf("GET /debug/pprof/ = %d, want 200", status)
+		}
+	})
+}
+
+// Profiling without any protection has to be asked for
+func TestPprofNeedsAuth(t *testing.T) {
+	if _, err := loadConfig([]string{"-enable-pprof"}); err == nil {
+		t.Error("-enable-pprof was accepted without an admin token or -pprof-no-auth")
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"net"
+	"net/url"
+	"os"
+	"time"
+)
+
+// preflightDialTimeout bounds the connection attempt to the upstream
+const preflightDialTimeout = 2 * time.Second
+
+// preflightCheck is one check of a configured feature. A failed fatal check
+// stops the server, any other only disables its feature.
+type preflightCheck struct {
+	name  string
+	fatal bool
+	run   func() error
+}
+
+// preflight checks the configured features before the server starts, so it
+// doesn't come up half broken. Binding the listen addresses, a usable TLS
+// certificate and a writable archive directory are fatal, an unreachable
+// upstream, a missing static or download directory or mock file and an
+// unreadable load average only get a warning. One summary line lists the outcome of every check.
+//
+// The listeners bound for the listen address and the -admin-addr, which is
+// nil without one, are returned for the servers to serve on.
+func (s *Server) preflight() (listener, adminListener net.Listener, err error) {
+	results := make(map[string]string)
+	checks := []preflightCheck{{name: "listen", fatal: true, run: func() (err error) {
+		listener, err = listen(s.cfg.Addr)
+		return err
+	}}}
+	if s.cfg.AdminAddr != "" {
+		checks = append(checks, preflightCheck{name: "admin_listen", fatal: true, run: func() (err error) {
+			adminListener, err = listen(s.cfg.AdminAddr)
+			return err
+		}})
+	}
+	if s.cfg.TLSCert != "" {
+		checks = append(checks, preflightCheck{name: "tls", fatal: true, run: func() error {
+			return checkCertificate(s.cfg.TLSCert, s.cfg.TLSKey, time.Now())
+		}})
+	}
+	if s.cfg.ArchiveDir != "" {
+		checks = append(checks, preflightCheck{name: "archive_dir", fatal: true, run: func() error {
+			return checkWritableDir(s.cfg.ArchiveDir)
+		}})
+	}
+	if s.cfg.Upstream != nil {
+		checks = append(checks, preflightCheck{name: "upstream", run: func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), preflightDialTimeout)
+			defer cancel()
+			return checkReachable(ctx, s.cfg.Upstream)
+		}})
+	}
+	if s.cfg.StaticDir != "" {
+		checks = append(checks, preflightCheck{name: "static_dir", run: func() error {
+			info, err := os.Stat(s.cfg.StaticDir)
+			if err == nil && !info.IsDir() {
+				err = fmt.Errorf("%s is not a directory", s.cfg.StaticDir)
+			}
+			return err
+		}})
+	}
+	if s.cfg.DownloadDir != "" {
+		checks = append(checks, preflightCheck{name: "download_dir", run: func() error {
+			info, err := os.Stat(s.cfg.DownloadDir)
+			if err == nil && !info.IsDir() {
+				err = fmt.Errorf("%s is not a directory", s.cfg.DownloadDir)
+			}
+			return err
+		}})
+	}
+	if s.cfg.ShedLoadAverage > 0 {
+		checks = append(checks, preflightCheck{name: "load_average", run: func() error {
+			_, err := readLoadAverage()
+			return err
+		}})
+	}
+	for _, path := range sortedKeys(s.cfg.MockFiles) {
+		file := s.cfg.MockFiles[path]
+		checks = append(checks, preflightCheck{name: "mock " + path, run: func() error {
+			_, err := os.Stat(file)
+			return err
+		}})
+	}
+
+	var failed error
+	for _, check := range checks {
+		err := check.run()
+		switch {
+		case err == nil:
+			results[check.name] = "ok"
+		case check.fatal:
+			results[check.name] = "failed: " + err.Error()
+			failed = errors.Join(failed, fmt.Errorf("%s: %w", check.name, err))
+		default:
+			results[check.name] = "unavailable: " + err.Error()
+			s.logger.Warn("preflight check failed, feature unavailable", zap.String("check", check.name), zap.Error(err))
+		}
+	}
+
+	if failed != nil {
+		s.logger.Error("preflight failed", zap.Any("checks", results))
+		for _, l := range []net.Listener{listener, adminListener} {
+			if l != nil {
+				l.Close()
+			}
+		}
+		return nil, nil, failed
+	}
+	s.logger.Info("preflight passed", zap.Any("checks", results))
+	return listener, adminListener, nil
+}
+
+// checkCertificate fails for a certificate pair that doesn't load or whose
+// certificate isn't valid at now
+func checkCertificate(certFile, keyFile string, now time.Time) error {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return err
+	}
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("certificate expired on %s", cert.NotAfter.Format(time.RFC3339))
+	}
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("certificate isn't valid before %s", cert.NotBefore.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// checkWritableDir creates dir if needed and makes sure files can be written
+// to it
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".preflight-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkReachable opens and closes a TCP connection to the host of upstream,
+// on the default port of its scheme when it has none
+func checkReachable(ctx context.Context, upstream *url.URL) error {
+	port := upstream.Port()
+	if port == "" {
+		port = "80"
+		if upstream.Scheme == "https" {
+			port = "443"
+		}
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(upstream.Hostname(), port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
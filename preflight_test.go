@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	defer upstream.Close()
+	dir := t.TempDir()
+	srv, logs := newObservedServer(t, "-addr", "127.0.0.1:0", "-upstream", upstream.URL, "-static-dir", dir, "-archive-dir", filepath.Join(dir, "archive"))
+
+	listener, adminListener, err := srv.preflight()
+	if err != nil {
+		t.Fatalf("preflight: %v", err)
+	}
+	defer listener.Close()
+	if adminListener != nil {
+		t.Error("got an admin listener without -admin-addr")
+	}
+	passed := logs.FilterMessage("preflight passed").All()
+	if len(passed) != 1 {
+		t.Fatalf("got %d preflight passed lines, want 1", len(passed))
+	}
+	checks := passed[0].ContextMap()["checks"].(map[string]string)
+	for _, name := range []string{"listen", "upstream", "static_dir", "archive_dir"} {
+		if checks[name] != "ok" {
+			t.Errorf("check %s = %v, want ok", name, checks[name])
+		}
+	}
+}
+
+// A missing optional feature is a warning, the server still starts
+func TestPreflightWarns(t *testing.T) {
+	srv, logs := newObservedServer(t, "-addr", "127.0.0.1:0", "-static-dir", filepath.Join(t.TempDir(), "missing"))
+	listener, _, err := srv.preflight()
+	if err != nil {
+		t.Fatalf("preflight: %v", err)
+	}
+	listener.Close()
+	warned := logs.FilterMessage("preflight check failed, feature unavailable").All()
+	if len(warned) != 1 || warned[0].ContextMap()["check"] != "static_dir" {
+		t.Errorf("warnings = %v, want one for static_dir", warned)
+	}
+}
+
+func TestPreflightFails(t *testing.T) {
+	// The archive directory can't be created below a regular file
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srv, logs := newObservedServer(t, "-addr", "127.0.0.1:0", "-archive-dir", filepath.Join(file, "archive"))
+
+	listener, _, err := srv.preflight()
+	if err == nil {
+		listener.Close()
+		t.Fatal("preflight passed with an unusable archive directory")
+	}
+	if !strings.Contains(err.Error(), "archive_dir") {
+		t.Errorf("error = %v, want it to name archive_dir", err)
+	}
+	if logs.FilterMessage("preflight failed").Len() != 1 {
+		t.Error("the failure wasn't logged")
+	}
+}
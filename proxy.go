@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+)
+
+// proxyPrefix is where the reverse proxy is mounted, it is stripped before
+// the request is forwarded
+const proxyPrefix = "/proxy"
+
+// proxyHandler forwards /proxy/... to the same path below upstream, e.g.
+// /proxy/users?id=1 to http://upstream/users?id=1, adding X-Forwarded-For,
+// X-Forwarded-Host, X-Forwarded-Proto and our X-Request-ID. Bodies are held to
+// -max-body-bytes like everywhere else. Upstream failures become a 502 in
+// the standard error shape. When timeout isn't 0 it bounds the wait for the
+// upstream's response headers, the body may then take as long as it takes.
+func (s *Server) proxyHandler(upstream *url.URL, timeout time.Duration) http.Handler {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(upstream)
+			pr.SetXForwarded()
+			// Lets the upstream's logs be matched up with ours
+			pr.Out.Header.Set("X-Request-ID", requestID(pr.In))
+		},
+		Transport: transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if errors.Is(err, context.Canceled) {
+				// The client gave up, writeResponse drops the answer anyway
+				return
+			}
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				s.writeError(w, r, ErrBodyTooLarge)
+				return
+			}
+			s.requestLogger(r).Warn("proxy request failed", zap.String("upstream", upstream.String()), zap.Error(err))
+			s.writeError(w, r, ErrBadGateway)
+		},
+	}
+	return http.StripPrefix(proxyPrefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes)
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+}
+
+// parseUpstream checks that the -upstream value is an absolute http(s) URL
+func parseUpstream(value string) (*url.URL, error) {
+	upstream, err := url.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	if (upstream.Scheme != "http" && upstream.Scheme != "https") || upstream.Host == "" {
+		return nil, errors.New("must be an absolute http or https URL")
+	}
+	return upstream, nil
+}
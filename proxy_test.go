@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newUpstream reports what reached it: path, query, forwarding headers and
+// body
+func newUpstream(t *testing.T) *httptest.Server {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Upstream", "yes")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{
+			"path":              r.URL.Path,
+			"query":             r.URL.RawQuery,
+			"x_forwarded_for":   r.Header.Get("X-Forwarded-For"),
+			"x_forwarded_host":  r.Header.Get("X-Forwarded-Host"),
+			"x_forwarded_proto": r.Header.Get("X-Forwarded-Proto"),
+			"x_request_id":      r.Header.Get("X-Request-ID"),
+			"body":              string(body),
+		})
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func TestProxy(t *testing.T) {
+	upstream := newUpstream(t)
+	srv, logs := newObservedServer(t, "-upstream", upstream.URL)
+	ts := startTestServer(t, srv)
+
+	resp, err := http.Post(ts.URL+"/proxy/users?id=1", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("POST /proxy/users: %v", err)
+	}
+	defer resp.Body.Close()
+	// The upstream's answer comes back as it is
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("X-Upstream") != "yes" {
+		t.Fatalf("status = %d, X-Upstream = %q, want the upstream's 201", resp.StatusCode, resp.Header.Get("X-Upstream"))
+	}
+	got := decodeJSON(t, resp.Body)
+	for name, want := range map[string]string{
+		"path":              "/users",
+		"query":             "id=1",
+		"x_forwarded_for":   "127.0.0.1",
+		"x_forwarded_host":  strings.TrimPrefix(ts.URL, "http://"),
+		"x_forwarded_proto": "http",
+		"x_request_id":      resp.Header.Get("X-Request-ID"),
+		"body":              "hello",
+	} {
+		if got[name] != want || want == "" {
+			t.Errorf("upstream saw %s = %v, want %q", name, got[name], want)
+		}
+	}
+
+	// The middleware logs proxied requests like any other
+	if logged := loggedRequest(t, logs); logged["path"] != "/proxy/users" {
+		t.Errorf("logged path = %v, want /proxy/users", logged["path"])
+	}
+}
+
+func TestProxyBodyLimit(t *testing.T) {
+	upstream := newUpstream(t)
+	ts := startTestServer(t, newTestServer(t, "-upstream", upstream.URL, "-max-body-bytes", "4"))
+
+	resp, err := http.Post(ts.URL+"/proxy/users", "text/plain", strings.NewReader("too long for the limit"))
+	if err != nil {
+		t.Fatalf("POST /proxy/users: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", resp.StatusCode)
+	}
+}
+
+func TestProxyUpstreamDown(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	upstream.Close()
+	handler := newTestHandler(t, newTestServer(t, "-upstream", upstream.URL))
+
+	rec := serve(handler, httptest.NewRequest(http.MethodGet, "/proxy/users", nil))
+	assertError(t, rec, http.StatusBadGateway, "bad_gateway")
+}
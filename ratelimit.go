@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"golang.org/x/time/rate"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimiterIdleTTL is how long a client's limiter is kept after its last
+// request. By then its bucket has refilled, so a fresh limiter is equivalent.
+const rateLimiterIdleTTL = 3 * time.Minute
+
+// rateLimiter hands out a token bucket per client IP
+type rateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu      sync.Mutex
+	clients map[string]*rateLimitedClient
+}
+
+type rateLimitedClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newRateLimiter allows each client limit requests per second on average,
+// with bursts of up to burst requests
+func newRateLimiter(limit float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		limit:   rate.Limit(limit),
+		burst:   burst,
+		clients: make(map[string]*rateLimitedClient),
+	}
+}
+
+// setLimits changes the rate and burst of every client, including the ones
+// already seen. A limit of 0 turns rate limiting off.
+func (rl *rateLimiter) setLimits(limit float64, burst int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.limit = rate.Limit(limit)
+	rl.burst = burst
+	for _, client := range rl.clients {
+		client.limiter.SetLimit(rl.limit)
+		client.limiter.SetBurst(rl.burst)
+	}
+}
+
+// enabled reports whether requests are limited at all
+func (rl *rateLimiter) enabled() bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.limit > 0
+}
+
+// limiterFor returns the limiter of the given client, creating it on first use
+func (rl *rateLimiter) limiterFor(key string) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	client, ok := rl.clients[key]
+	if !ok {
+		client = &rateLimitedClient{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.clients[key] = client
+	}
+	client.lastSeen = time.Now()
+	return client.limiter
+}
+
+// evictIdle forgets clients that haven't made a request within ttl, keeping
+// the map from growing with every address ever seen
+func (rl *rateLimiter) evictIdle(ttl time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for key, client := range rl.clients {
+		if time.Since(client.lastSeen) > ttl {
+			delete(rl.clients, key)
+		}
+	}
+}
+
+// runEviction evicts idle clients every minute until ctx is done
+func (rl *rateLimiter) runEviction(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			rl.evictIdle(rateLimiterIdleTTL)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Name and Check make the limiter a HealthChecker. Every request passes
+// through it, so a limiter that can't be locked stalls the whole server.
+func (rl *rateLimiter) Name() string { return "rate_limiter" }
+
+func (rl *rateLimiter) Check(context.Context) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return nil
+}
+
+// rateLimitMiddleware answers 429 with a Retry-After header once a client
+// has used up its bucket
+func (s *Server) rateLimitMiddleware(rl *rateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !rl.enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			reservation := rl.limiterFor(s.clientIP(r)).Reserve()
+			if !reservation.OK() {
+				s.writeError(w, r, ErrRateLimited)
+				return
+			}
+			if delay := reservation.Delay(); delay > 0 {
+				// The request is refused, give the token back
+				reservation.Cancel()
+				w.Header().Set("Retry-After", retryAfterSeconds(delay))
+				s.writeError(w, r, ErrRateLimited)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-rate-limit", "0.01", "-rate-burst", "3", "-trusted-proxies", "10.0.0.0/8"))
+	request := func(remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/get", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		return serve(handler, req)
+	}
+
+	for i := 0; i < 3; i++ {
+		if rec := request("192.0.2.1:1234", ""); rec.Code != http.StatusOK {
+			t.Fatalf("request %d within the burst: status = %d, want 200", i+1, rec.Code)
+		}
+	}
+	rec := request("192.0.2.1:1234", "")
+	retryAfter := rec.Header().Get("Retry-After")
+	assertError(t, rec, http.StatusTooManyRequests, "rate_limited")
+	if seconds, err := strconv.Atoi(retryAfter); err != nil || seconds < 1 || seconds > 100 {
+		t.Errorf("Retry-After = %q, want whole seconds until the next token", retryAfter)
+	}
+
+	// Buckets are per IP: another client has its own, a new port doesn't help
+	if rec := request("192.0.2.2:1234", ""); rec.Code != http.StatusOK {
+		t.Errorf("other client: status = %d, want 200", rec.Code)
+	}
+	if rec := request("192.0.2.1:5678", ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("same IP, new port: status = %d, want 429", rec.Code)
+	}
+
+	// Behind a trusted proxy the forwarded client is limited, not the proxy
+	for i := 0; i < 3; i++ {
+		request("10.0.0.1:80", "198.51.100.7")
+	}
+	if rec := request("10.0.0.1:80", "198.51.100.7"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("forwarded client past its burst: status = %d, want 429", rec.Code)
+	}
+	if rec := request("10.0.0.1:80", "198.51.100.8"); rec.Code != http.StatusOK {
+		t.Errorf("another client through the same proxy: status = %d, want 200", rec.Code)
+	}
+	// An untrusted peer can't pick its own bucket
+	if rec := request("192.0.2.1:1234", "198.51.100.9"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("spoofed X-Forwarded-For: status = %d, want 429", rec.Code)
+	}
+}
+
+func TestRateLimiterEvictsIdle(t *testing.T) {
+	rl := newRateLimiter(1, 1)
+	rl.limiterFor("192.0.2.1")
+	rl.clients["192.0.2.1"].lastSeen = time.Now().Add(-time.Hour)
+	rl.limiterFor("192.0.2.2")
+
+	rl.evictIdle(time.Minute)
+	if _, ok := rl.clients["192.0.2.1"]; ok {
+		t.Errorf("idle client was kept")
+	}
+	if _, ok := rl.clients["192.0.2.2"]; !ok {
+		t.Errorf("active client was evicted")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
+	"syscall"
+	"unicode"
+)
+
+// reloadableSettings are the Config fields a SIGHUP applies to the running
+// server, every other change only takes effect after a restart
+var reloadableSettings = []string{"LogLevel", "RateLimit", "RateBurst", "CORSOrigins", "ChaosLatency", "ChaosJitter", "ChaosErrorRate"}
+
+// watchReload re-reads the configuration on every SIGHUP until ctx is done.
+// Flags and environment are the same as at startup, so in practice this picks
+// up edits to the config file.
+func (s *Server) watchReload(ctx context.Context, current *Config, cors *corsPolicy, limiter *rateLimiter, chaos *chaosPolicy) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-hup:
+			if next, ok := s.reloadConfig(current, cors, limiter, chaos); ok {
+				current = next
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reloadConfig loads the configuration again and swaps in the settings that
+// can change at runtime. An invalid configuration is rejected as a whole and
+// the server keeps running with the old one.
+func (s *Server) reloadConfig(current *Config, cors *corsPolicy, limiter *rateLimiter, chaos *chaosPolicy) (*Config, bool) {
+	s.logger.Info("reloading configuration")
+	next, err := loadConfig(os.Args[1:])
+	if err != nil {
+		s.logger.Error("configuration reload failed, keeping the current configuration", zap.Error(err))
+		return nil, false
+	}
+	level, ok := parseLogLevel(next.LogLevel)
+	if !ok {
+		s.logger.Error("configuration reload failed, keeping the current configuration",
+			zap.String("error", "invalid log level "+next.LogLevel))
+		return nil, false
+	}
+	for _, warning := range next.Warnings {
+		s.logger.Warn(warning)
+	}
+
+	if next.LogLevel != current.LogLevel {
+		s.logLevel.SetLevel(level)
+		s.logger.Info("setting reloaded", zap.String("setting", "log-level"),
+			zap.String("old", current.LogLevel), zap.String("new", next.LogLevel))
+	}
+	if next.RateLimit != current.RateLimit || next.RateBurst != current.RateBurst {
+		limiter.setLimits(next.RateLimit, next.RateBurst)
+		s.logger.Info("setting reloaded", zap.String("setting", "rate-limit"),
+			zap.Float64("old_limit", current.RateLimit), zap.Float64("new_limit", next.RateLimit),
+			zap.Int("old_burst", current.RateBurst), zap.Int("new_burst", next.RateBurst))
+	}
+	if !slices.Equal(next.CORSOrigins, current.CORSOrigins) {
+		cors.set(next.CORSOrigins)
+		s.logger.Info("setting reloaded", zap.String("setting", "cors-origins"),
+			zap.Strings("old", current.CORSOrigins), zap.Strings("new", next.CORSOrigins))
+	}
+	if next.ChaosLatency != current.ChaosLatency || next.ChaosJitter != current.ChaosJitter || next.ChaosErrorRate != current.ChaosErrorRate {
+		chaos.set(next.ChaosLatency, next.ChaosJitter, next.ChaosErrorRate)
+		s.logger.Info("setting reloaded", zap.String("setting", "chaos"),
+			zap.Duration("old_latency", current.ChaosLatency), zap.Duration("new_latency", next.ChaosLatency),
+			zap.Duration("old_jitter", current.ChaosJitter), zap.Duration("new_jitter", next.ChaosJitter),
+			zap.Float64("old_error_rate", current.ChaosErrorRate), zap.Float64("new_error_rate", next.ChaosErrorRate))
+	}
+
+	// Values are left out, some of these are secrets
+	for _, name := range changedSettings(current, next) {
+		if !slices.Contains(reloadableSettings, name) {
+			s.logger.Warn("setting changed, requires restart", zap.String("setting", settingName(name)))
+		}
+	}
+
+	// The other settings are still in effect as they were at startup, keep
+	// diffing against those so the warning repeats until the restart
+	restartOnly := *current
+	restartOnly.LogLevel = next.LogLevel
+	restartOnly.RateLimit = next.RateLimit
+	restartOnly.RateBurst = next.RateBurst
+	restartOnly.CORSOrigins = next.CORSOrigins
+	restartOnly.ChaosLatency = next.ChaosLatency
+	restartOnly.ChaosJitter = next.ChaosJitter
+	restartOnly.ChaosErrorRate = next.ChaosErrorRate
+	return &restartOnly, true
+}
+
+// changedSettings lists the names of the Config fields that differ.
+// Unexported fields are parsed forms of exported ones and are skipped.
+func changedSettings(old, next *Config) []string {
+	var changed []string
+	oldValue, nextValue := reflect.ValueOf(old).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < oldValue.NumField(); i++ {
+		field := oldValue.Type().Field(i)
+		name := field.Name
+		if name == "Warnings" || !field.IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), nextValue.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// settingName turns a Config field name into the flag style name it is
+// configured with, e.g. MaxBodyBytes into max-body-bytes and TLSCert into
+// tls-cert
+func settingName(field string) string {
+	runes := []rune(field)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			afterLower := unicode.IsLower(runes[i-1])
+			endsAcronym := unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if afterLower || endsAcronym {
+				b.WriteByte('-')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
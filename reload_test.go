@@ -0,0 +1,96 @@
+package main
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(contents string) {
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("log-level: info\naddr: \":8080\"\n")
+	// reloadConfig parses the command line again
+	args := os.Args
+	os.Args = []string{"go-simple-server", "-config", path}
+	t.Cleanup(func() { os.Args = args })
+
+	srv, logs := newObservedServer(t, os.Args[1:]...)
+	srv.logLevel.SetLevel(zap.InfoLevel)
+	cors := newCORSPolicy(srv.cfg.CORSOrigins)
+	limiter := newRateLimiter(srv.cfg.RateLimit, srv.cfg.RateBurst)
+	chaos := newChaosPolicy(srv.cfg.ChaosLatency, srv.cfg.ChaosJitter, srv.cfg.ChaosErrorRate)
+
+	writeConfig("log-level: warn\naddr: \":9090\"\nrate-limit: 5\n")
+	next, ok := srv.reloadConfig(srv.cfg, cors, limiter, chaos)
+	if !ok {
+		t.Fatalf("reload failed: %v", logs.All())
+	}
+	if got := srv.logLevel.Level(); got != zapcore.WarnLevel {
+		t.Errorf("log level = %s, want warn", got)
+	}
+	if !limiter.enabled() {
+		t.Errorf("the rate limit wasn't applied")
+	}
+	reloaded := logs.FilterMessage("setting reloaded").FilterField(zap.String("setting", "log-level")).All()
+	if len(reloaded) != 1 || reloaded[0].ContextMap()["new"] != "warn" {
+		t.Errorf("log-level reload logged as %v", reloaded)
+	}
+	// The address needs a new listener, it stays as it was
+	if restart := logs.FilterMessage("setting changed, requires restart").FilterField(zap.String("setting", "addr")); restart.Len() != 1 {
+		t.Errorf("addr change logged %d times, want once", restart.Len())
+	}
+	if next.Addr != ":8080" {
+		t.Errorf("addr = %s, want the one from startup", next.Addr)
+	}
+
+	// An invalid configuration is rejected as a whole
+	writeConfig("log-level: loud\nrate-limit: 1\n")
+	if _, ok := srv.reloadConfig(next, cors, limiter, chaos); ok {
+		t.Errorf("an invalid log level was accepted")
+	}
+	if got := srv.logLevel.Level(); got != zapcore.WarnLevel {
+		t.Errorf("log level after a failed reload = %s, want warn", got)
+	}
+}
+
+// Parsing the same -response-template again isn't a change
+func TestReloadConfigResponseTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(contents string) {
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("response-template: \"{{.Path}}\"\n")
+	args := os.Args
+	os.Args = []string{"go-simple-server", "-config", path}
+	t.Cleanup(func() { os.Args = args })
+
+	srv, logs := newObservedServer(t, os.Args[1:]...)
+	cors := newCORSPolicy(srv.cfg.CORSOrigins)
+	limiter := newRateLimiter(srv.cfg.RateLimit, srv.cfg.RateBurst)
+	chaos := newChaosPolicy(srv.cfg.ChaosLatency, srv.cfg.ChaosJitter, srv.cfg.ChaosErrorRate)
+
+	next, ok := srv.reloadConfig(srv.cfg, cors, limiter, chaos)
+	if !ok {
+		t.Fatalf("reload failed: %v", logs.All())
+	}
+	if restart := logs.FilterMessage("setting changed, requires restart"); restart.Len() != 0 {
+		t.Errorf("an unchanged template logged %v", restart.All())
+	}
+
+	writeConfig("response-template: \"{{.Method}}\"\n")
+	if _, ok := srv.reloadConfig(next, cors, limiter, chaos); !ok {
+		t.Fatalf("reload failed: %v", logs.All())
+	}
+	if restart := logs.FilterMessage("setting changed, requires restart").FilterField(zap.String("setting", "response-template")); restart.Len() != 1 {
+		t.Errorf("template change logged %d times, want once", restart.Len())
+	}
+}
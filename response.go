@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"go.uber.org/zap"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writeResponse sends payload with the given status code, encoded as XML when
+// the request's Accept header prefers it and payload is one of the typed
+// responses, as JSON otherwise. The Content-Type is set to match unless the
+// handler already set one. Output is indented for ?pretty=true or with -pretty.
+//
+// The payload is encoded before anything is sent, so a value that can't be
+// encoded still results in a proper 500 instead of a truncated body.
+func (s *Server) writeResponse(w http.ResponseWriter, r *http.Request, status int, payload interface{}) {
+	// requestIDMiddleware has already put the ID on the response
+	requestID := zap.String("request_id", w.Header().Get("X-Request-ID"))
+
+	// The client is gone, a response would only end in a broken pipe
+	if errors.Is(r.Context().Err(), context.Canceled) {
+		s.logger.Debug("client disconnected, response dropped", requestID, zap.Int("status", status))
+		return
+	}
+
+	encode, contentType := encodeJSON, "application/json"
+	if prefersXML(r) && xmlEncodable(payload) {
+		encode, contentType = encodeXML, "application/xml"
+	}
+
+	pretty := s.wantsPretty(r)
+	var buf bytes.Buffer
+	start := time.Now()
+	err := encode(&buf, payload, pretty)
+	addServerTiming(r, "encode", time.Since(start))
+	if err != nil {
+		s.logger.Error("failed to encode response", requestID, zap.Int("status", status), zap.Error(err))
+		status = http.StatusInternalServerError
+		buf.Reset()
+		encode(&buf, errorPayload(ErrInternal), pretty)
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	// The body depends on Accept, caches must keep the variants apart
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		// Usually the client hung up, there is no one left to tell
+		s.logger.Error("failed to write response", requestID, zap.Int("status", status), zap.Error(err))
+	}
+}
+
+// streamBufferSize is how much of a streamed response is collected before it
+// is written to the client
+const streamBufferSize = 32 << 10
+
+// writeReflectedResponse is writeResponse for payloads reflecting a request
+// body of bodyLength bytes. Past -stream-response-bytes the JSON is encoded
+// straight to the client instead of into a buffer holding another copy of
+// the body. XML is always buffered. The handler timeout buffers every
+// response itself, so this only saves the copy with -handler-timeout 0.
+//
+// The status is sent before encoding starts, which is fine for these
+// payloads: they hold nothing but strings, numbers and string lists, which
+// always encode.
+func (s *Server) writeReflectedResponse(w http.ResponseWriter, r *http.Request, status int, payload interface{}, bodyLength int) {
+	if s.cfg.StreamBodyBytes == 0 || int64(bodyLength) <= s.cfg.StreamBodyBytes || prefersXML(r) {
+		s.writeResponse(w, r, status, payload)
+		return
+	}
+
+	requestID := zap.String("request_id", w.Header().Get("X-Request-ID"))
+	if errors.Is(r.Context().Err(), context.Canceled) {
+		s.logger.Debug("client disconnected, response dropped", requestID, zap.Int("status", status))
+		return
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+
+	buffered := bufio.NewWriterSize(w, streamBufferSize)
+	encoder := json.NewEncoder(buffered)
+	if s.wantsPretty(r) {
+		encoder.SetIndent("", "  ")
+	}
+	err := encoder.Encode(payload)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		s.logger.Error("failed to write response", requestID, zap.Int("status", status), zap.Error(err))
+	}
+}
+
+// writeError sends an error response in the standard error shape, or the
+// body configured for the status with -not-found-body and the like
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, err *APIError) {
+	if body, ok := s.cfg.ErrorBodies[err.Status]; ok {
+		s.writeResponse(w, r, err.Status, renderErrorBody(body, r, err))
+		return
+	}
+	s.writeResponse(w, r, err.Status, errorPayload(err))
+}
+
+// ErrorResponse is the standard error shape,
+// {"error":{"code":...,"message":...},"status_code":...}. Errors lists the
+// schema violations of a 422.
+type ErrorResponse struct {
+	XMLName    xml.Name         `json:"-" xml:"response"`
+	Error      *APIError        `json:"error" xml:"error"`
+	Errors     schemaViolations `json:"errors,omitempty" xml:"errors,omitempty"`
+	StatusCode int              `json:"status_code" xml:"status_code"`
+}
+
+// errorPayload builds the standard error shape for err
+func errorPayload(err *APIError) ErrorResponse {
+	return ErrorResponse{Error: err, StatusCode: err.Status}
+}
+
+// ReflectedResponse is the body of the endpoints reflecting a request, /get,
+// /post and the like. Its fields are sorted by key, the way maps are encoded.
+type ReflectedResponse struct {
+	XMLName     xml.Name    `json:"-" xml:"response"`
+	Body        string      `json:"body,omitempty" xml:"body,omitempty"`
+	BodyLength  int         `json:"body_length,omitempty" xml:"body_length,omitempty"`
+	ContentType string      `json:"content_type,omitempty" xml:"content_type,omitempty"`
+	Form        multiValues `json:"form,omitempty" xml:"form,omitempty"`
+	Hint        string      `json:"hint,omitempty" xml:"hint,omitempty"`
+	IP          string      `json:"ip,omitempty" xml:"ip,omitempty"`
+	Message     string      `json:"message,omitempty" xml:"message,omitempty"`
+	Path        string      `json:"path,omitempty" xml:"path,omitempty"`
+	QueryParams multiValues `json:"query_params,omitempty" xml:"query_params,omitempty"`
+	StatusCode  int         `json:"status_code" xml:"status_code"`
+}
+
+// wantsPretty reports whether the response should be indented: ?pretty= when
+// it is a valid boolean, the -pretty default otherwise
+func (s *Server) wantsPretty(r *http.Request) bool {
+	if pretty, err := strconv.ParseBool(r.URL.Query().Get("pretty")); err == nil {
+		return pretty
+	}
+	return s.cfg.Pretty
+}
+
+func encodeJSON(buf *bytes.Buffer, payload interface{}, pretty bool) error {
+	encoder := json.NewEncoder(buf)
+	if pretty {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder.Encode(payload)
+}
+
+// encodeXML writes payload as XML. The typed responses name their root
+// element <response> and tag every field for both encoders.
+func encodeXML(buf *bytes.Buffer, payload interface{}, pretty bool) error {
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(buf)
+	if pretty {
+		encoder.Indent("", "  ")
+	}
+	if err := encoder.Encode(payload); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	return nil
+}
+
+// xmlEncodable reports whether payload can be sent as XML. Maps have no
+// element names to offer, endpoints answering with one always send JSON.
+func xmlEncodable(payload interface{}) bool {
+	_, isMap := payload.(map[string]interface{})
+	return !isMap
+}
+
+// multiValues is a map of repeatable values such as query parameters or
+// headers. As XML each key becomes an element holding an <item> per value,
+// keys that aren't valid element names, such as header names with spaces,
+// become <entry key="..."> instead.
+type multiValues map[string][]string
+
+func (v multiValues) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		elem := xml.StartElement{Name: xml.Name{Local: key}}
+		if !validXMLName(key) {
+			elem = xml.StartElement{
+				Name: xml.Name{Local: "entry"},
+				Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: key}},
+			}
+		}
+		if err := enc.EncodeToken(elem); err != nil {
+			return err
+		}
+		for _, value := range v[key] {
+			if err := enc.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: "item"}}); err != nil {
+				return err
+			}
+		}
+		if err := enc.EncodeToken(elem.End()); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// validXMLName reports whether name can be used as an element name as is.
+// It is stricter than the XML spec, which is fine for a fallback.
+func validXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case i > 0 && (c >= '0' && c <= '9' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// prefersXML reports whether the Accept header ranks XML strictly above JSON.
+// A missing header, */* and ties all mean JSON.
+func prefersXML(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return false
+	}
+	return acceptQuality(accept, "application", "xml", "text") > acceptQuality(accept, "application", "json", "")
+}
+
+// acceptQuality returns the q value the Accept header gives to type/subtype,
+// or to altType/subtype when altType is set, using the most specific match
+func acceptQuality(accept, typ, subtype, altType string) float64 {
+	best, bestSpecificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		rangeType, rangeSubtype, _ := strings.Cut(mediaType, "/")
+
+		specificity := -1
+		switch {
+		case mediaType == "*/*":
+			specificity = 0
+		case (rangeType == typ || altType != "" && rangeType == altType) && rangeSubtype == "*":
+			specificity = 1
+		case (rangeType == typ || altType != "" && rangeType == altType) && rangeSubtype == subtype:
+			specificity = 2
+		}
+		if specificity < 0 || specificity < bestSpecificity {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if specificity > bestSpecificity || q > best {
+			best, bestSpecificity = q, specificity
+		}
+	}
+	return best
+}
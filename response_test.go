@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteResponseEncodeError(t *testing.T) {
+	srv, logs := newObservedServer(t)
+	rec := httptest.NewRecorder()
+	rec.Header().Set("X-Request-ID", "req-1")
+	srv.writeResponse(rec, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, map[string]interface{}{
+		"unencodable": make(chan int),
+	})
+
+	assertError(t, rec, http.StatusInternalServerError, "internal_error")
+	entries := logs.FilterMessage("failed to encode response").All()
+	if len(entries) != 1 || entries[0].ContextMap()["request_id"] != "req-1" {
+		t.Errorf("logged %v, want one error with the request ID", entries)
+	}
+}
+
+// failingWriter accepts the headers but fails every body write, like a client
+// that hung up
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (f failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestWriteResponseWriteError(t *testing.T) {
+	srv, logs := newObservedServer(t)
+	w := failingWriter{httptest.NewRecorder()}
+	w.Header().Set("X-Request-ID", "req-2")
+	srv.writeResponse(w, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, map[string]interface{}{"ok": true})
+
+	entries := logs.FilterMessage("failed to write response").All()
+	if len(entries) != 1 || entries[0].ContextMap()["request_id"] != "req-2" {
+		t.Errorf("logged %v, want one error with the request ID", entries)
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	tests := []struct {
+		accept      string
+		contentType string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"application/json", "application/json"},
+		{"application/xml", "application/xml"},
+		{"text/xml", "application/xml"},
+		{"text/*", "application/xml"},
+		{"application/xml;q=0.5, application/json", "application/json"},
+		{"application/json;q=0.5, application/xml", "application/xml"},
+		{"application/xml;q=0.9, */*;q=0.8", "application/xml"},
+		// JSON only matches */*, which ranks higher here
+		{"application/xml;q=0.8, */*;q=0.9", "application/json"},
+		// Ties go to JSON
+		{"application/xml, application/json", "application/json"},
+		{"application/*", "application/json"},
+		{"application/xml;q=0", "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/get?tag=a&tag=b", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := serve(handler, req)
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Fatalf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if !slices.Contains(rec.Header().Values("Vary"), "Accept") {
+				t.Errorf("Vary = %q, want Accept in it", rec.Header().Values("Vary"))
+			}
+
+			if tt.contentType == "application/json" {
+				if body := decodeJSON(t, rec.Body); body["path"] != "/get" {
+					t.Errorf("JSON body = %v", body)
+				}
+				return
+			}
+			var body struct {
+				XMLName xml.Name `xml:"response"`
+				Path    string   `xml:"path"`
+				Status  int      `xml:"status_code"`
+				Tags    []string `xml:"query_params>tag>item"`
+			}
+			if err := xml.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding %s: %v", rec.Body, err)
+			}
+			if body.Path != "/get" || body.Status != http.StatusOK || !slices.Equal(body.Tags, []string{"a", "b"}) {
+				t.Errorf("XML body = %+v", body)
+			}
+		})
+	}
+}
+
+func TestXMLErrors(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/does-not-exist", nil)
+	req.Header.Set("Accept", "application/xml")
+	rec := serve(newTestHandler(t, newTestServer(t)), req)
+
+	var body struct {
+		Code   string `xml:"error>code"`
+		Status int    `xml:"status_code"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	if rec.Code != http.StatusNotFound || body.Code != "not_found" || body.Status != http.StatusNotFound {
+		t.Errorf("response = %d %+v", rec.Code, body)
+	}
+	if strings.Contains(rec.Body.String(), "<errors>") {
+		t.Errorf("empty schema errors are encoded: %s", rec.Body)
+	}
+}
+
+// Endpoints answering with a map have nothing to name XML elements after
+func TestXMLFallsBackToJSON(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/version", nil)
+	req.Header.Set("Accept", "application/xml")
+	rec := serve(newTestHandler(t, newTestServer(t)), req)
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if body := decodeJSON(t, rec.Body); body["go_version"] == nil {
+		t.Errorf("body = %v, want the version information", body)
+	}
+}
+
+func TestPretty(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		query  string
+		pretty bool
+	}{
+		{"compact by default", nil, "", false},
+		{"?pretty=true", nil, "?pretty=true", true},
+		{"-pretty", []string{"-pretty"}, "", true},
+		{"?pretty=false overrides -pretty", []string{"-pretty"}, "?pretty=false", false},
+		{"invalid ?pretty= keeps the default", nil, "?pretty=very", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(newTestHandler(t, newTestServer(t, tt.args...)), httptest.NewRequest(http.MethodGet, "/get"+tt.query, nil))
+			body := rec.Body.String()
+			indented := strings.Contains(body, "\n  \"")
+			if indented != tt.pretty || strings.Count(body, "\n") > 1 != tt.pretty {
+				t.Errorf("body = %q, want pretty %v", body, tt.pretty)
+			}
+			decodeJSON(t, rec.Body)
+		})
+	}
+
+	// Errors go through the same encoder
+	rec := serve(newTestHandler(t, newTestServer(t)), httptest.NewRequest(http.MethodGet, "/does-not-exist?pretty=true", nil))
+	if !strings.Contains(rec.Body.String(), "\n  \"error\": {\n") {
+		t.Errorf("error body = %q, want it indented", rec.Body)
+	}
+}
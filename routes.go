@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// route is one entry of the route table, which drives both the mux
+// registration and the endpoint list printed at startup
+type route struct {
+	method      string // method shown in the banner, empty when any method is accepted
+	path        string // mux pattern
+	usage       string // path shown in the banner when it differs from the pattern
+	description string
+	handler     http.Handler
+	// middleware wraps handler for this route only, the first one is the
+	// outermost like with chain
+	middleware []func(http.Handler) http.Handler
+	// streaming routes flush their response as they go, which
+	// http.TimeoutHandler doesn't support, so they get no handler timeout
+	streaming bool
+}
+
+// routes builds the route table for the configuration. Routes that depend on
+// optional settings are only included when those are enabled. requestShutdown
+// is what /admin/shutdown calls.
+func (s *Server) routes(requestShutdown func()) []route {
+	// Both are no-ops unless credentials are configured
+	protected := []func(http.Handler) http.Handler{
+		s.basicAuthMiddleware(s.cfg.BasicAuthUsername, s.cfg.BasicAuthPassword),
+		s.apiKeyMiddleware(s.cfg.APIKeys),
+	}
+
+	kv := newKVStore(s)
+	s.registerHealthCheck(kv, false)
+
+	table := []route{
+		{method: http.MethodGet, path: "/get", description: "reflect the query parameters", handler: s.methodHandler(http.MethodGet, s.handleGet)},
+		{method: http.MethodPost, path: "/post", description: "reflect the request body", handler: s.methodHandler(http.MethodPost, s.handlePost), middleware: append(protected, s.archiveMiddleware(s.cfg.ArchiveDir), s.idempotencyMiddleware(newIdempotencyStore(s.cfg.IdempotencyTTL)))},
+		{method: http.MethodPut, path: "/put", description: "reflect the request body", handler: s.methodHandler(http.MethodPut, s.handlePut)},
+		{method: http.MethodPatch, path: "/patch", description: "reflect the request body", handler: s.methodHandler(http.MethodPatch, s.handlePatch)},
+		{method: http.MethodDelete, path: "/delete", description: "acknowledge a delete", handler: s.methodHandler(http.MethodDelete, s.handleDelete)},
+		{method: http.MethodGet, path: "/version", description: "build information", handler: s.methodHandler(http.MethodGet, s.handleVersion)},
+		{path: "/echo", description: "echo the full request", handler: http.HandlerFunc(s.handleEcho)},
+		{method: http.MethodGet, path: "/whoami", description: "resolved client address, TLS and identity", handler: s.methodHandler(http.MethodGet, s.handleWhoami)},
+		{path: "/status/", usage: "/status/{code}", description: "respond with the given status code", handler: http.HandlerFunc(s.handleStatus)},
+		{method: http.MethodGet, path: "/stream", description: "stream JSON lines", handler: s.methodHandler(http.MethodGet, s.handleStream), streaming: true},
+		{method: http.MethodGet, path: "/delay-stream", description: "trickle bytes at a fixed rate", handler: s.methodHandler(http.MethodGet, s.handleDelayStream), streaming: true},
+		{method: http.MethodGet, path: "/events", description: "Server-Sent Events", handler: s.methodHandler(http.MethodGet, s.handleEvents), streaming: true},
+		{method: http.MethodGet, path: "/ws", description: "WebSocket echo", handler: s.methodHandler(http.MethodGet, s.handleWebSocket()), streaming: true},
+		{path: "/kv/", usage: "/kv/{key}", description: "GET, PUT or DELETE JSON in an in-memory store", handler: kv},
+		{method: http.MethodGet, path: "/mock", usage: "/mock?type={type}&count={n}&seed={seed}", description: "deterministic fake records", handler: s.methodHandler(http.MethodGet, s.handleFakeData)},
+		{method: http.MethodGet, path: "/expensive", usage: "/expensive?key={key}&duration={d}", description: "slow computation shared by concurrent requests", handler: s.methodHandler(http.MethodGet, s.handleExpensive())},
+		{path: "/flaky", usage: "/flaky?key={key}&fail={n}", description: "fail n times per key, then succeed", handler: newFlakyStore(s)},
+	}
+	// With -admin-addr the probes, metrics and profiler move to the admin server
+	if s.cfg.AdminAddr == "" {
+		table = append(table, s.adminRoutes()...)
+	}
+
+	// Stopping the server over HTTP is only possible once a token is configured
+	if s.cfg.AdminToken != "" {
+		table = append(table, route{method: http.MethodPost, path: "/admin/shutdown", description: "graceful shutdown", handler: s.methodHandler(http.MethodPost, s.handleAdminShutdown(s.cfg.AdminToken, requestShutdown))})
+	}
+	// The upstream may stream, so the proxy gets no handler timeout, that
+	// only applies to the wait for the upstream's response headers
+	if s.cfg.Upstream != nil {
+		table = append(table, route{path: proxyPrefix + "/", usage: proxyPrefix + "/{path}", description: "forward to " + s.cfg.Upstream.String(), handler: s.proxyHandler(s.cfg.Upstream, s.cfg.HandlerTimeout), streaming: true})
+	}
+	if s.cfg.StaticDir != "" {
+		if handler := s.staticHandler(s.cfg.StaticDir, s.cfg.StaticPrefix, s.cfg.StaticMaxAge); handler != nil {
+			table = append(table, route{method: http.MethodGet, path: s.cfg.StaticPrefix, description: "static files", handler: handler, streaming: true})
+		}
+	}
+
+	if s.cfg.DownloadDir != "" {
+		table = append(table, route{method: http.MethodGet, path: "/download/", usage: "/download/{file}", description: "download files, resumable with Range", handler: s.downloadHandler(s.cfg.DownloadDir), streaming: true})
+	}
+
+	// A mock can't replace a built-in route, the mux panics on duplicates
+	taken := make(map[string]bool, len(table))
+	for _, rt := range table {
+		taken[rt.path] = true
+	}
+	for _, path := range sortedKeys(s.cfg.MockFiles) {
+		file := s.cfg.MockFiles[path]
+		if taken[path] || path == "/" || path == "/routes" {
+			s.logger.Warn("mock file path is already routed, ignoring it", zap.String("path", path), zap.String("file", file))
+			continue
+		}
+		table = append(table, route{path: path, description: "mock " + file, handler: s.mockFileHandler(file)})
+	}
+
+	// The handler reads table when called, so it lists every route including
+	// itself and the root
+	table = append(table, route{method: http.MethodGet, path: "/routes", description: "list the routes", handler: s.methodHandler(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		s.handleRoutes(w, r, table)
+	})})
+
+	// Welcome message at the root, anything else that matched no route is a 404
+	table = append(table, route{method: http.MethodGet, path: "/", description: "welcome message", handler: http.HandlerFunc(s.handleRoot)})
+
+	// Handlers keep seeing the paths without the base path. The table is
+	// updated in place, so /routes lists the paths clients use.
+	if s.cfg.BasePath != "" {
+		for i, rt := range table {
+			if table[i].path = s.routePath(rt.path); table[i].path == rt.path {
+				continue
+			}
+			if rt.usage != "" {
+				table[i].usage = s.cfg.BasePath + rt.usage
+			}
+			table[i].handler = http.StripPrefix(s.cfg.BasePath, rt.handler)
+		}
+	}
+	return table
+}
+
+// adminRoutes are the operational routes, served by the main server or on
+// their own under -admin-addr
+func (s *Server) adminRoutes() []route {
+	table := []route{
+		{method: http.MethodGet, path: "/health", description: "liveness probe", handler: s.methodHandler(http.MethodGet, s.healthCheck)},
+		{method: http.MethodGet, path: "/readiness", description: "readiness probe", handler: s.methodHandler(http.MethodGet, s.readinessCheck)},
+		{method: http.MethodGet, path: "/metrics", description: "Prometheus metrics", handler: s.methodHandler(http.MethodGet, promhttp.Handler().ServeHTTP)},
+	}
+	// Profiles can take a while to record, e.g. ?seconds=30
+	if s.cfg.EnablePprof {
+		table = append(table, route{method: http.MethodGet, path: pprofPrefix, usage: pprofPrefix + "{profile}", description: "profiling", handler: s.pprofHandler(), streaming: true})
+	}
+	return table
+}
+
+// routePath is where the route for path is served: under -base-path, unless
+// it is a probe kept at the root by -health-at-root
+func (s *Server) routePath(path string) string {
+	if s.cfg.BasePath == "" || s.cfg.HealthAtRoot && (path == "/health" || path == "/readiness") {
+		return path
+	}
+	return s.cfg.BasePath + path
+}
+
+// isProbe reports whether r is for /health or /readiness
+func (s *Server) isProbe(r *http.Request) bool {
+	return r.URL.Path == s.routePath("/health") || r.URL.Path == s.routePath("/readiness")
+}
+
+// displayMethod is the method shown for the route, ANY when every method is accepted
+func (rt route) displayMethod() string {
+	if rt.method == "" {
+		return "ANY"
+	}
+	return rt.method
+}
+
+// displayPath is the path shown for the route
+func (rt route) displayPath() string {
+	if rt.usage == "" {
+		return rt.path
+	}
+	return rt.usage
+}
+
+// handleRoutes lists the route table as JSON, the runtime counterpart of the
+// startup banner
+func (s *Server) handleRoutes(w http.ResponseWriter, r *http.Request, table []route) {
+	list := make([]map[string]string, 0, len(table))
+	for _, rt := range table {
+		list = append(list, map[string]string{
+			"method":      rt.displayMethod(),
+			"path":        rt.displayPath(),
+			"description": rt.description,
+		})
+	}
+	s.writeResponse(w, r, http.StatusOK, map[string]interface{}{
+		"routes":      list,
+		"status_code": http.StatusOK,
+	})
+}
+
+// registerRoutes adds every route of the table to the mux. Unless timeout is
+// 0, handlers of non-streaming routes that take longer than timeout are cut
+// off with a 503. Unless deadline is 0, their request context expires after
+// deadline.
+func registerRoutes(mux *http.ServeMux, table []route, timeout, deadline time.Duration) {
+	for _, rt := range table {
+		handler := chain(rt.handler, rt.middleware...)
+		if !rt.streaming {
+			handler = deadlineMiddleware(deadline)(handler)
+		}
+		if timeout > 0 && !rt.streaming {
+			handler = timeoutHandler(handler, timeout)
+		}
+		mux.Handle(rt.path, handler)
+	}
+}
+
+// timeoutHandler is http.TimeoutHandler answering in the standard JSON error shape
+func timeoutHandler(next http.Handler, timeout time.Duration) http.Handler {
+	body, _ := json.Marshal(errorPayload(ErrTimeout))
+	th := http.TimeoutHandler(next, timeout, string(body))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &timeoutResponseWriter{ResponseWriter: w, r: r, vary: w.Header().Values("Vary")}
+		th.ServeHTTP(tw, r)
+	})
+}
+
+// timeoutResponseWriter patches up what http.TimeoutHandler gets wrong.
+//
+// The handler runs against a header map of its own, which is copied over the
+// real one key by key, so a Vary set by the handler would replace the values
+// the middleware outside added. Those are put back.
+//
+// The timeout body is written without a Content-Type, so it is labeled as
+// JSON. A handler's own 503 arrives with its headers already copied over, so
+// an unset type means timeout.
+//
+// It also answers 503 when the client disconnects, that response is dropped.
+type timeoutResponseWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	vary    []string
+	dropped bool
+}
+
+func (t *timeoutResponseWriter) WriteHeader(status int) {
+	if status == http.StatusServiceUnavailable && errors.Is(t.r.Context().Err(), context.Canceled) {
+		t.dropped = true
+		return
+	}
+	if len(t.vary) > 0 {
+		merged := append([]string(nil), t.vary...)
+		for _, value := range t.Header().Values("Vary") {
+			if !slices.Contains(merged, value) {
+				merged = append(merged, value)
+			}
+		}
+		t.Header()["Vary"] = merged
+	}
+	if status == http.StatusServiceUnavailable && t.Header().Get("Content-Type") == "" {
+		t.Header().Set("Content-Type", "application/json")
+	}
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *timeoutResponseWriter) Write(b []byte) (int, error) {
+	if t.dropped {
+		return len(b), nil
+	}
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *timeoutResponseWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// printRoutes writes the endpoint list of the startup banner
+func printRoutes(w io.Writer, table []route) {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	for _, rt := range table {
+		fmt.Fprintf(tw, "  %s\t%s\t %s\n", rt.displayMethod(), rt.displayPath(), rt.description)
+	}
+	tw.Flush()
+}
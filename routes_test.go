@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHandlerTimeout(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	flushing := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			time.Sleep(20 * time.Millisecond)
+			w.Write([]byte("tick\n"))
+			w.(http.Flusher).Flush()
+		}
+	})
+	mux := http.NewServeMux()
+	registerRoutes(mux, []route{
+		{path: "/slow", handler: slow},
+		{path: "/flushing", handler: flushing, streaming: true},
+	}, 30*time.Millisecond, 0)
+
+	rec := serve(mux, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assertError(t, rec, http.StatusServiceUnavailable, "timeout")
+
+	// Streaming routes outlive the timeout, a recorder can flush too
+	rec = serve(mux, httptest.NewRequest(http.MethodGet, "/flushing", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "tick\ntick\ntick\n" || !rec.Flushed {
+		t.Errorf("streaming route = %d %q, flushed %v, want the whole stream", rec.Code, rec.Body, rec.Flushed)
+	}
+}
+
+// The streaming endpoints of the route table are the ones left alone
+func TestHandlerTimeoutSparesStreams(t *testing.T) {
+	ts := startTestServer(t, newTestServer(t, "-handler-timeout", "30ms"))
+
+	resp, err := http.Get(ts.URL + "/stream?count=4&interval=20ms")
+	if err != nil {
+		t.Fatalf("GET /stream: %v", err)
+	}
+	defer resp.Body.Close()
+	lines := 0
+	for scanner := bufio.NewScanner(resp.Body); scanner.Scan(); {
+		lines++
+	}
+	if resp.StatusCode != http.StatusOK || lines != 4 {
+		t.Errorf("GET /stream = %d with %d lines, want 200 with 4", resp.StatusCode, lines)
+	}
+
+	resp, err = http.Get(ts.URL + "/get?delay=100ms")
+	if err != nil {
+		t.Fatalf("GET /get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("GET /get past the timeout = %d, want 503", resp.StatusCode)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	rec := serve(newTestHandler(t, newTestServer(t)), httptest.NewRequest(http.MethodGet, "/routes", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	listed := make(map[string]map[string]interface{})
+	for _, r := range decodeJSON(t, rec.Body)["routes"].([]interface{}) {
+		rt := r.(map[string]interface{})
+		listed[rt["path"].(string)] = rt
+	}
+	for path, method := range map[string]string{
+		"/get":           "GET",
+		"/post":          "POST",
+		"/echo":          "ANY",
+		"/status/{code}": "ANY",
+		"/health":        "GET",
+		"/routes":        "GET",
+		"/":              "GET",
+	} {
+		rt, ok := listed[path]
+		if !ok {
+			t.Errorf("%s is not listed", path)
+			continue
+		}
+		if rt["method"] != method || rt["description"] == "" {
+			t.Errorf("%s = %v, want method %s and a description", path, rt, method)
+		}
+	}
+}
+
+// Under -base-path the listing shows the paths clients use
+func TestRoutesBasePath(t *testing.T) {
+	rec := serve(newTestHandler(t, newTestServer(t, "-base-path", "/api")), httptest.NewRequest(http.MethodGet, "/api/routes", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var paths []string
+	for _, r := range decodeJSON(t, rec.Body)["routes"].([]interface{}) {
+		paths = append(paths, r.(map[string]interface{})["path"].(string))
+	}
+	if !slices.Contains(paths, "/api/get") || !slices.Contains(paths, "/api/status/{code}") {
+		t.Errorf("routes = %v, want them under /api", paths)
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		status map[string]int
+	}{
+		{"health at the root", []string{"-base-path", "/api/"}, map[string]int{
+			"/api/get":    http.StatusOK,
+			"/get":        http.StatusNotFound,
+			"/health":     http.StatusOK,
+			"/api/health": http.StatusNotFound,
+		}},
+		{"health under the prefix", []string{"-base-path", "/api", "-health-at-root=false"}, map[string]int{
+			"/api/get":       http.StatusOK,
+			"/api/health":    http.StatusOK,
+			"/api/readiness": http.StatusOK,
+			"/health":        http.StatusNotFound,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newTestHandler(t, newTestServer(t, tt.args...))
+			for path, want := range tt.status {
+				if rec := serve(handler, httptest.NewRequest(http.MethodGet, path, nil)); rec.Code != want {
+					t.Errorf("GET %s = %d, want %d", path, rec.Code, want)
+				}
+			}
+		})
+	}
+
+	// Handlers see the path without the prefix
+	handler := newTestHandler(t, newTestServer(t, "-base-path", "/api"))
+	if got := decodeJSON(t, serve(handler, httptest.NewRequest(http.MethodGet, "/api/get", nil)).Body)["path"]; got != "/get" {
+		t.Errorf("path = %v, want /get", got)
+	}
+}
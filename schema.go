@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"net/http"
+	"sort"
+)
+
+// loadSchema compiles the JSON Schema file at path, references to other
+// files are resolved relative to it
+func loadSchema(path string) (*jsonschema.Schema, error) {
+	schema, err := jsonschema.Compile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JSON schema: %v", err)
+	}
+	return schema, nil
+}
+
+// schemaViolation is one reason a body failed validation
+type schemaViolation struct {
+	Path    string `json:"path" xml:"path"`
+	Message string `json:"message" xml:"message"`
+}
+
+// schemaViolations are all the reasons a body failed validation. As XML they
+// are <violation> elements inside the field's element.
+type schemaViolations []schemaViolation
+
+func (v schemaViolations) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return enc.EncodeElement(struct {
+		Violations []schemaViolation `xml:"violation"`
+	}{v}, start)
+}
+
+// writeSchemaErrors responds 422 listing where and why the body failed validation
+func (s *Server) writeSchemaErrors(w http.ResponseWriter, r *http.Request, err error) {
+	var violations schemaViolations
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) {
+		violations = collectViolations(validationErr, nil)
+		sort.SliceStable(violations, func(i, j int) bool {
+			return violations[i].Path < violations[j].Path
+		})
+	} else {
+		violations = []schemaViolation{{Path: "", Message: err.Error()}}
+	}
+
+	response := errorPayload(ErrValidationFailed)
+	response.Errors = violations
+	s.writeResponse(w, r, http.StatusUnprocessableEntity, response)
+}
+
+// collectViolations flattens the error tree into its leaves, the inner nodes
+// only say that some nested keyword failed
+func collectViolations(err *jsonschema.ValidationError, violations []schemaViolation) []schemaViolation {
+	if len(err.Causes) == 0 {
+		return append(violations, schemaViolation{Path: err.InstanceLocation, Message: err.Message})
+	}
+	for _, cause := range err.Causes {
+		violations = collectViolations(cause, violations)
+	}
+	return violations
+}
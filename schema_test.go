@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSchema = `{
+	"type": "object",
+	"required": ["name"],
+	"properties": {
+		"name": {"type": "string"},
+		"age": {"type": "integer", "minimum": 0}
+	}
+}`
+
+func TestPostSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte(testSchema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, "-post-schema", path)
+	var err error
+	if srv.postSchema, err = loadSchema(path); err != nil {
+		t.Fatalf("loadSchema: %v", err)
+	}
+	handler := newTestHandler(t, srv)
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return serve(handler, req)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		rec := post(`{"name": "ada", "age": 36}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200, body %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		rec := post(`{"age": -1}`)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("status = %d, want 422, body %s", rec.Code, rec.Body)
+		}
+		body := decodeJSON(t, rec.Body)
+		if code := body["error"].(map[string]interface{})["code"]; code != "validation_failed" {
+			t.Errorf("error code = %v, want validation_failed", code)
+		}
+		violations, _ := body["errors"].([]interface{})
+		paths := make(map[string]bool)
+		for _, v := range violations {
+			violation := v.(map[string]interface{})
+			if msg, _ := violation["message"].(string); msg == "" {
+				t.Errorf("violation %v has no message", violation)
+			}
+			paths[violation["path"].(string)] = true
+		}
+		// The missing name is reported on the object, the bad age on itself
+		if len(violations) != 2 || !paths[""] || !paths["/age"] {
+			t.Errorf("errors = %v, want the root and /age", violations)
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		assertError(t, post(`{"name": `), http.StatusBadRequest, "invalid_body")
+	})
+}
+
+// Without a schema any JSON goes
+func TestPostWithoutSchema(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(`{"age": -1}`))
+	req.Header.Set("Content-Type", "application/json")
+	if rec := serve(newTestHandler(t, newTestServer(t)), req); rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+}
+
+func TestLoadSchemaInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte(`{"type": 12}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSchema(path); err == nil {
+		t.Error("an invalid schema was accepted")
+	}
+}
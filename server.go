@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Server holds what the handlers and middleware share, so that tests can
+// build one with their own logger, configuration and dependencies, and one
+// process can run several side by side
+type Server struct {
+	logger *zap.Logger
+	cfg    *Config
+	// logLevel is the level of logger, a SIGHUP reload changes it in place
+	logLevel zap.AtomicLevel
+	// newRequestID generates the ID of requests that don't bring a usable
+	// X-Request-ID, tests can swap in a deterministic generator
+	newRequestID func() string
+	// random returns a number in [0, 1) for chaosMiddleware, tests can swap
+	// in a seeded source
+	random func() float64
+
+	// postSchema validates /post bodies when -post-schema is set
+	postSchema *jsonschema.Schema
+	// accessLog receives a combined log line for every request when
+	// -access-log-format is combined, it is nil otherwise
+	accessLog zapcore.WriteSyncer
+
+	// ready reports whether the server is accepting traffic: it is set once
+	// the listener is bound and cleared as soon as shutdown starts
+	ready atomic.Bool
+	// shuttingDown is closed when a graceful shutdown starts. Streaming
+	// handlers watch it so a long or endless stream doesn't hold up Shutdown.
+	shuttingDown chan struct{}
+	// background tracks work that outlives its request and that shutdown
+	// waits for: open /ws connections and archive writes
+	background sync.WaitGroup
+
+	// healthChecks are the subsystem checks /health runs
+	healthChecks []registeredCheck
+
+	// startTime is when the server was created, for the uptime in /health
+	startTime time.Time
+	// requestsServed counts the requests handled since start, it is
+	// incremented by loggingMiddleware
+	requestsServed atomic.Uint64
+	// inFlight counts the requests concurrencyLimitMiddleware currently lets
+	// through, it is reported by /health
+	inFlight atomic.Int64
+}
+
+// newServer returns a Server generating request IDs from the clock. logLevel
+// is the level logger was built with.
+func newServer(cfg *Config, logger *zap.Logger, logLevel zap.AtomicLevel) *Server {
+	return &Server{
+		logger:       logger,
+		cfg:          cfg,
+		logLevel:     logLevel,
+		newRequestID: timestampRequestID,
+		random:       rand.Float64,
+		shuttingDown: make(chan struct{}),
+		startTime:    time.Now(),
+	}
+}
+
+// newHandler builds the handler of the main server: the route table on a mux
+// wrapped in the middleware applied to every request. The rate limiter's
+// eviction, the load average sampling and SIGHUP reloads run until ctx is
+// done. tracing adds the OpenTelemetry middleware, initTracing must have
+// installed a provider by then.
+func (s *Server) newHandler(ctx context.Context, requestShutdown func(), tracing bool) (http.Handler, []route) {
+	mux := http.NewServeMux()
+	table := s.routes(requestShutdown)
+	registerRoutes(mux, table, s.cfg.HandlerTimeout, s.cfg.RequestDeadline)
+	// The welcome route moved under the base path, keep 404s outside it JSON
+	if s.cfg.BasePath != "" {
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			s.writeError(w, r, ErrNotFound)
+		})
+	}
+
+	// SIGHUP swaps these in place, see reload.go
+	cors := newCORSPolicy(s.cfg.CORSOrigins)
+	limiter := newRateLimiter(s.cfg.RateLimit, s.cfg.RateBurst)
+	s.registerHealthCheck(limiter, true)
+	if s.cfg.Upstream != nil {
+		s.registerHealthCheck(upstreamHealthCheck(s.cfg.Upstream), false)
+	}
+	go limiter.runEviction(ctx)
+	chaos := newChaosPolicy(s.cfg.ChaosLatency, s.cfg.ChaosJitter, s.cfg.ChaosErrorRate)
+	go s.watchReload(ctx, s.cfg, cors, limiter, chaos)
+	shedder := newLoadShedder(s.cfg.ShedLoadAverage)
+	go shedder.run(ctx)
+
+	// Excluded routes are named without the base path
+	metricsExclude := make([]string, len(s.cfg.MetricsExclude))
+	for i, path := range s.cfg.MetricsExclude {
+		metricsExclude[i] = s.routePath(path)
+	}
+
+	// Middleware applied to every request, from the outermost to the innermost
+	middleware := []func(http.Handler) http.Handler{s.requestIDMiddleware}
+	if tracing {
+		middleware = append(middleware, tracingMiddleware(mux))
+	}
+	middleware = append(middleware, s.loggingMiddleware, metricsMiddleware(mux, metricsExclude))
+	if s.cfg.ServerTiming {
+		middleware = append(middleware, serverTimingMiddleware)
+	}
+	middleware = append(middleware,
+		s.recoverMiddleware,
+		s.trailingSlashMiddleware(mux, s.cfg.TrailingSlash),
+		responseHeadersMiddleware(s.cfg.ResponseHeaders),
+		s.allowCIDRMiddleware(s.cfg.AllowCIDRs),
+		corsMiddleware(cors),
+		s.optionsMiddleware(mux, table),
+		s.rateLimitMiddleware(limiter),
+		s.loadShedMiddleware(shedder, s.cfg.OverloadRetryAfter),
+		s.concurrencyLimitMiddleware(s.cfg.MaxConcurrent, s.cfg.ConcurrencyQueue, s.cfg.QueueTimeout, s.cfg.OverloadRetryAfter),
+		s.chaosMiddleware(chaos),
+		s.decompressMiddleware,
+		gzipMiddleware)
+	return chain(mux, middleware...), table
+}
+
+// newAdminHandler builds the handler of the -admin-addr server. The admin
+// routes skip most of the middleware, rate limits or chaos shouldn't fail a
+// probe.
+func (s *Server) newAdminHandler() (http.Handler, []route) {
+	mux := http.NewServeMux()
+	table := s.adminRoutes()
+	registerRoutes(mux, table, s.cfg.HandlerTimeout, s.cfg.RequestDeadline)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		s.writeError(w, r, ErrNotFound)
+	})
+	return chain(mux, s.requestIDMiddleware, s.loggingMiddleware, s.recoverMiddleware), table
+}
+
+// timestampRequestID is the default request ID, the current time in nanoseconds
+func timestampRequestID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 10)
+}
+
+// waitBackground waits until the background work has finished or ctx is
+// done. net/http lets go of hijacked connections and knows nothing about
+// archive writes, so Shutdown doesn't wait for them on its own.
+func (s *Server) waitBackground(ctx context.Context) {
+	finished := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"go.uber.org/zap/zaptest/observer"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newTestServer builds a ready Server from the flags in args, logging to t
+func newTestServer(t *testing.T, args ...string) *Server {
+	t.Helper()
+	cfg, err := loadConfig(args)
+	if err != nil {
+		t.Fatalf("loadConfig(%q): %v", args, err)
+	}
+	level := zap.NewAtomicLevelAt(zap.DebugLevel)
+	srv := newServer(cfg, zaptest.NewLogger(t, zaptest.Level(level)), level)
+	srv.ready.Store(true)
+	return srv
+}
+
+// newObservedServer is newTestServer with the log lines kept for the test to
+// inspect
+func newObservedServer(t *testing.T, args ...string) (*Server, *observer.ObservedLogs) {
+	t.Helper()
+	srv := newTestServer(t, args...)
+	core, logs := observer.New(zap.DebugLevel)
+	srv.logger = zap.New(core)
+	return srv, logs
+}
+
+// newTestHandler returns the full handler of srv, middleware included. Its
+// background work stops when the test ends.
+func newTestHandler(t *testing.T, srv *Server) http.Handler {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	handler, _ := srv.newHandler(ctx, func() {}, false)
+	return handler
+}
+
+// serve sends req to h and returns the recorded response
+func serve(h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeJSON decodes a JSON object response body
+func decodeJSON(t *testing.T, body io.Reader) map[string]interface{} {
+	t.Helper()
+	var decoded map[string]interface{}
+	if err := json.NewDecoder(body).Decode(&decoded); err != nil {
+		t.Fatalf("decoding response body: %v", err)
+	}
+	return decoded
+}
+
+// assertError checks that rec holds the standard error shape with the given
+// status and code
+func assertError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d, body %s", rec.Code, status, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	body := decodeJSON(t, rec.Body)
+	apiErr, ok := body["error"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("error = %v, want an object", body["error"])
+	}
+	if apiErr["code"] != code {
+		t.Errorf("error code = %v, want %s", apiErr["code"], code)
+	}
+	if msg, _ := apiErr["message"].(string); msg == "" {
+		t.Errorf("error message is empty")
+	}
+	if body["status_code"] != float64(status) {
+		t.Errorf("status_code = %v, want %d", body["status_code"], status)
+	}
+}
+
+func TestServerHandlers(t *testing.T) {
+	srv := newTestServer(t)
+
+	rec := serve(http.HandlerFunc(srv.handleGet), httptest.NewRequest(http.MethodGet, "/get?a=1&a=2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /get status = %d, want 200", rec.Code)
+	}
+	body := decodeJSON(t, rec.Body)
+	if body["path"] != "/get" || body["status_code"] != float64(200) {
+		t.Errorf("GET /get body = %v", body)
+	}
+	if got := body["query_params"].(map[string]interface{})["a"]; len(got.([]interface{})) != 2 {
+		t.Errorf("query_params.a = %v, want both values", got)
+	}
+
+	rec = serve(http.HandlerFunc(srv.handleRoot), httptest.NewRequest(http.MethodGet, "/nope", nil))
+	assertError(t, rec, http.StatusNotFound, "not_found")
+}
+
+// Two servers with different configurations must not affect each other
+func TestServersSideBySide(t *testing.T) {
+	plain := newTestHandler(t, newTestServer(t))
+	pretty := newTestHandler(t, newTestServer(t, "-pretty", "-response-headers", "X-Instance: pretty"))
+
+	rec := serve(plain, httptest.NewRequest(http.MethodGet, "/get", nil))
+	if strings.Contains(rec.Body.String(), "\n  ") || rec.Header().Get("X-Instance") != "" {
+		t.Errorf("plain server picked up the pretty server's settings: %q %v", rec.Body, rec.Header())
+	}
+	rec = serve(pretty, httptest.NewRequest(http.MethodGet, "/get", nil))
+	if !strings.Contains(rec.Body.String(), "\n  ") || rec.Header().Get("X-Instance") != "pretty" {
+		t.Errorf("pretty server body %q, headers %v", rec.Body, rec.Header())
+	}
+}
+
+// A counter makes the request IDs predictable, in the response and the log
+func TestRequestIDGenerator(t *testing.T) {
+	srv, logs := newObservedServer(t)
+	n := 0
+	srv.newRequestID = func() string {
+		n++
+		return "req-" + strconv.Itoa(n)
+	}
+	handler := newTestHandler(t, srv)
+
+	for _, want := range []string{"req-1", "req-2"} {
+		rec := serve(handler, httptest.NewRequest(http.MethodGet, "/get", nil))
+		if got := rec.Header().Get("X-Request-ID"); got != want {
+			t.Errorf("X-Request-ID = %q, want %q", got, want)
+		}
+	}
+	entries := logs.FilterMessage("request received").All()
+	if len(entries) != 2 {
+		t.Fatalf("got %d request log lines, want 2", len(entries))
+	}
+	for i, entry := range entries {
+		if got, want := entry.ContextMap()["id"], "req-"+strconv.Itoa(i+1); got != want {
+			t.Errorf("logged id = %v, want %s", got, want)
+		}
+	}
+
+	// A usable client ID is kept and the generator isn't consulted
+	req := httptest.NewRequest(http.MethodGet, "/get", nil)
+	req.Header.Set("X-Request-ID", "client-id")
+	if got := serve(handler, req).Header().Get("X-Request-ID"); got != "client-id" || n != 2 {
+		t.Errorf("X-Request-ID = %q after %d generated IDs, want client-id after 2", got, n)
+	}
+}
+
+// With -admin-addr the operational routes move to the admin handler
+func TestAdminHandler(t *testing.T) {
+	srv := newTestServer(t, "-admin-addr", "127.0.0.1:0")
+	public := startTestServer(t, srv)
+	adminHandler, _ := srv.newAdminHandler()
+	admin := httptest.NewServer(adminHandler)
+	defer admin.Close()
+
+	tests := []struct {
+		server *httptest.Server
+		path   string
+		want   int
+	}{
+		{admin, "/health", http.StatusOK},
+		{admin, "/readiness", http.StatusOK},
+		{admin, "/metrics", http.StatusOK},
+		{admin, "/get", http.StatusNotFound},
+		{public, "/health", http.StatusNotFound},
+		{public, "/metrics", http.StatusNotFound},
+		{public, "/get", http.StatusOK},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(tt.server.URL + tt.path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			name := map[bool]string{true: "admin", false: "main"}[tt.server == admin]
+			t.Errorf("GET %s on the %s server = %d, want %d", tt.path, name, resp.StatusCode, tt.want)
+		}
+	}
+
+	// Both servers are drained by the same shutdown
+	srv.shutdown(public.Config, admin.Config)
+	for _, ts := range []*httptest.Server{public, admin} {
+		if resp, err := http.Get(ts.URL + "/health"); err == nil {
+			resp.Body.Close()
+			t.Errorf("%s still served after shutdown", ts.URL)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type serverTimingKey struct{}
+
+// serverTimings collects the phases of a request reported in the
+// Server-Timing header
+type serverTimings struct {
+	mu      sync.Mutex
+	metrics []string
+}
+
+// addServerTiming records a phase of the request, e.g. reading the body.
+// Phases recorded after the response headers were sent are left out.
+func addServerTiming(r *http.Request, name string, d time.Duration) {
+	if timings, ok := r.Context().Value(serverTimingKey{}).(*serverTimings); ok {
+		timings.mu.Lock()
+		timings.metrics = append(timings.metrics, serverTimingMetric(name, d))
+		timings.mu.Unlock()
+	}
+}
+
+// serverTimingMetric formats a metric as the Server-Timing spec wants it,
+// the duration in milliseconds
+func serverTimingMetric(name string, d time.Duration) string {
+	return name + ";dur=" + strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 2, 64)
+}
+
+// serverTimingMiddleware adds a Server-Timing header with the phases handlers
+// recorded and the total time until the response headers went out, which
+// browser devtools show next to the request
+func serverTimingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timings := &serverTimings{}
+		r = r.WithContext(context.WithValue(r.Context(), serverTimingKey{}, timings))
+		next.ServeHTTP(&serverTimingWriter{ResponseWriter: w, start: time.Now(), timings: timings}, r)
+	})
+}
+
+// serverTimingWriter sets the Server-Timing header right before the response
+// headers are sent
+type serverTimingWriter struct {
+	http.ResponseWriter
+	start       time.Time
+	timings     *serverTimings
+	wroteHeader bool
+}
+
+func (t *serverTimingWriter) WriteHeader(status int) {
+	// Informational responses precede the real one
+	if !t.wroteHeader && status >= 200 {
+		t.wroteHeader = true
+		t.timings.mu.Lock()
+		metrics := append(t.timings.metrics, serverTimingMetric("total", time.Since(t.start)))
+		t.timings.mu.Unlock()
+		t.Header().Set("Server-Timing", strings.Join(metrics, ", "))
+	}
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *serverTimingWriter) Write(b []byte) (int, error) {
+	if !t.wroteHeader {
+		t.WriteHeader(http.StatusOK)
+	}
+	return t.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers flush through the writer
+func (t *serverTimingWriter) Flush() {
+	if !t.wroteHeader {
+		t.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := t.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (t *serverTimingWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// parseServerTiming returns the durations of a Server-Timing header by
+// metric name, failing on anything that isn't name;dur=<ms>
+func parseServerTiming(t *testing.T, header string) map[string]float64 {
+	t.Helper()
+	metrics := make(map[string]float64)
+	for _, metric := range strings.Split(header, ", ") {
+		name, dur, ok := strings.Cut(metric, ";dur=")
+		ms, err := strconv.ParseFloat(dur, 64)
+		if !ok || name == "" || err != nil || ms < 0 {
+			t.Fatalf("malformed Server-Timing metric %q in %q", metric, header)
+		}
+		metrics[name] = ms
+	}
+	return metrics
+}
+
+func TestServerTiming(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	tests := []struct {
+		method string
+		path   string
+		want   []string
+	}{
+		{http.MethodGet, "/get", []string{"encode", "total"}},
+		{http.MethodPost, "/post", []string{"read", "encode", "total"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := serve(handler, httptest.NewRequest(tt.method, tt.path, strings.NewReader("body")))
+			header := rec.Header().Get("Server-Timing")
+			metrics := parseServerTiming(t, header)
+			if len(metrics) != len(tt.want) {
+				t.Errorf("Server-Timing = %q, want %v", header, tt.want)
+			}
+			for _, name := range tt.want {
+				if _, ok := metrics[name]; !ok {
+					t.Errorf("Server-Timing = %q, want %s in it", header, name)
+				}
+			}
+			// The total covers every phase
+			if metrics["total"] < metrics["encode"] {
+				t.Errorf("total %v is shorter than encode %v", metrics["total"], metrics["encode"])
+			}
+		})
+	}
+}
+
+func TestServerTimingDisabled(t *testing.T) {
+	rec := serve(newTestHandler(t, newTestServer(t, "-server-timing=false")), httptest.NewRequest(http.MethodGet, "/get", nil))
+	if got := rec.Header().Get("Server-Timing"); got != "" {
+		t.Errorf("Server-Timing = %q, want none", got)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// trailingSlashMiddleware fixes up a trailing slash that keeps a request
+// from reaching its route, following policy:
+//
+//   - strip serves /get/ as /get
+//   - add serves /kv as /kv/ instead of the mux redirecting to it
+//   - redirect sends /get/ to /get, with the query string, a 301 for GET and
+//     HEAD and a 308 otherwise so the method and body are kept
+//
+// A path is only changed when the other form is a route, anything else is
+// left to the mux, and off leaves every path alone.
+func (s *Server) trailingSlashMiddleware(mux *http.ServeMux, policy string) func(http.Handler) http.Handler {
+	root := s.routePath("/")
+	return func(next http.Handler) http.Handler {
+		if policy == "off" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := r.URL.Path
+			_, pattern := mux.Handler(r)
+			var other string
+			switch {
+			case pattern == path:
+			case strings.HasSuffix(path, "/") && path != "/" && (pattern == "/" || pattern == root) && policy != "add":
+				other = strings.TrimSuffix(path, "/")
+			case !strings.HasSuffix(path, "/") && policy == "add":
+				other = path + "/"
+			}
+			if other == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			changed := new(http.Request)
+			*changed = *r
+			changed.URL = new(url.URL)
+			*changed.URL = *r.URL
+			changed.URL.Path, changed.URL.RawPath = other, ""
+			if _, pattern := mux.Handler(changed); pattern != other {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if policy != "redirect" {
+				next.ServeHTTP(w, changed)
+				return
+			}
+			status := http.StatusMovedPermanently
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				status = http.StatusPermanentRedirect
+			}
+			target := changed.URL.EscapedPath()
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, status)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrailingSlash(t *testing.T) {
+	tests := []struct {
+		policy   string
+		method   string
+		target   string
+		status   int
+		location string
+	}{
+		// /get/ falls through to the catch-all
+		{"off", http.MethodGet, "/get/?a=1", http.StatusNotFound, ""},
+		{"strip", http.MethodGet, "/get/?a=1", http.StatusOK, ""},
+		// add only ever adds a slash
+		{"add", http.MethodGet, "/get/?a=1", http.StatusNotFound, ""},
+		{"redirect", http.MethodGet, "/get/?a=1", http.StatusMovedPermanently, "/get?a=1"},
+		{"redirect", http.MethodPost, "/post/", http.StatusPermanentRedirect, "/post"},
+		// Unknown paths are left to the mux
+		{"strip", http.MethodGet, "/nope/", http.StatusNotFound, ""},
+		{"redirect", http.MethodGet, "/nope/", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+" "+tt.method+" "+tt.target, func(t *testing.T) {
+			handler := newTestHandler(t, newTestServer(t, "-trailing-slash", tt.policy))
+			rec := serve(handler, httptest.NewRequest(tt.method, tt.target, nil))
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("Location"); got != tt.location {
+				t.Errorf("Location = %q, want %q", got, tt.location)
+			}
+			if tt.policy == "strip" && rec.Code == http.StatusOK {
+				body := decodeJSON(t, rec.Body)
+				if body["path"] != "/get" || body["query_params"].(map[string]interface{})["a"] == nil {
+					t.Errorf("body = %v, want /get with the query", body)
+				}
+			}
+		})
+	}
+}
+
+// With add, /kv reaches /kv/ without the mux's redirect
+func TestTrailingSlashAdd(t *testing.T) {
+	for policy, want := range map[string]int{"off": http.StatusMovedPermanently, "add": http.StatusBadRequest} {
+		rec := serve(newTestHandler(t, newTestServer(t, "-trailing-slash", policy)), httptest.NewRequest(http.MethodGet, "/kv", nil))
+		if rec.Code != want {
+			t.Errorf("-trailing-slash %s: GET /kv = %d, want %d", policy, rec.Code, want)
+		}
+	}
+}
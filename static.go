@@ -0,0 +1,95 @@
+package main
+
+import (
+	"go.uber.org/zap"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// staticHandler serves the files in dir under prefix. A missing directory
+// only disables static serving, it doesn't stop the server from starting, and
+// staticHandler returns nil. preflight warns about it.
+//
+// Files get an ETag and a Cache-Control header with maxAge, no-cache when it
+// is 0 so clients always revalidate. http.FileServer adds Last-Modified and
+// answers If-None-Match and If-Modified-Since with a 304.
+func (s *Server) staticHandler(dir, prefix string, maxAge time.Duration) http.Handler {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return nil
+	}
+
+	cacheControl := "no-cache"
+	if maxAge > 0 {
+		cacheControl = "public, max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+	}
+
+	files := noListingFS{http.Dir(dir)}
+	fileServer := http.FileServer(files)
+	s.logger.Info("serving static files", zap.String("dir", dir), zap.String("prefix", prefix))
+	return http.StripPrefix(strings.TrimSuffix(prefix, "/"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := statFile(files, r.URL.Path); ok {
+			w.Header().Set("ETag", fileETag(info))
+			w.Header().Set("Cache-Control", cacheControl)
+			s.setMIMEType(w, info.Name())
+		}
+		fileServer.ServeHTTP(w, r)
+	}))
+}
+
+// statFile returns the info of the file served for name: the file itself, or
+// the index.html of a directory requested with a trailing slash. Anything
+// else is left to http.FileServer, which redirects or answers 404.
+func statFile(files http.FileSystem, name string) (fs.FileInfo, bool) {
+	if strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+	f, err := files.Open(path.Clean("/" + name))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return nil, false
+	}
+	return info, true
+}
+
+// fileETag derives an ETag from the size and modification time, which
+// changes whenever the file does without having to hash its contents
+func fileETag(info fs.FileInfo) string {
+	return `"` + strconv.FormatInt(info.Size(), 16) + "-" + strconv.FormatInt(info.ModTime().UnixNano(), 16) + `"`
+}
+
+// noListingFS hides directories without an index.html so http.FileServer
+// answers 404 instead of exposing the file tree
+type noListingFS struct {
+	fs http.FileSystem
+}
+
+func (n noListingFS) Open(name string) (http.File, error) {
+	f, err := n.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		index, err := n.fs.Open(path.Join(name, "index.html"))
+		if err != nil {
+			f.Close()
+			return nil, os.ErrNotExist
+		}
+		index.Close()
+	}
+	return f, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticConditionalRequests(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	handler := newTestHandler(t, newTestServer(t, "-static-dir", dir, "-static-max-age", "1h"))
+
+	rec := serve(handler, httptest.NewRequest(http.MethodGet, "/static/hello.txt", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Fatalf("first GET = %d %q, want the file", rec.Code, rec.Body)
+	}
+	etag, lastModified := rec.Header().Get("ETag"), rec.Header().Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		t.Fatalf("ETag %q, Last-Modified %q, want both", etag, lastModified)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "public, max-age=3600" {
+		t.Errorf("Cache-Control = %q, want public, max-age=3600", got)
+	}
+
+	for name, header := range map[string][2]string{
+		"If-None-Match":     {"If-None-Match", etag},
+		"If-Modified-Since": {"If-Modified-Since", lastModified},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/static/hello.txt", nil)
+			req.Header.Set(header[0], header[1])
+			rec := serve(handler, req)
+			if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+				t.Errorf("conditional GET = %d %q, want an empty 304", rec.Code, rec.Body)
+			}
+		})
+	}
+
+	// A changed file gets a new ETag, the old one no longer matches
+	if err := os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello again"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/static/hello.txt", nil)
+	req.Header.Set("If-None-Match", etag)
+	if rec := serve(handler, req); rec.Code != http.StatusOK || rec.Body.String() != "hello again" {
+		t.Errorf("GET after a change = %d %q, want the new contents", rec.Code, rec.Body)
+	}
+}
+
+func TestStaticNoCacheByDefault(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(newTestHandler(t, newTestServer(t, "-static-dir", dir)), httptest.NewRequest(http.MethodGet, "/static/hello.txt", nil))
+	if got := rec.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Cache-Control = %q, want no-cache", got)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// handleStatus responds with whatever status code the last path segment
+// asks for, e.g. /status/503, to exercise client error handling. A 1xx code
+// is sent as an informational response, and the body that follows it comes
+// with the implicit 200 net/http sends. 101 is refused, it would promise a
+// protocol switch that never happens.
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	code, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/status/"))
+	if err != nil || code < 100 || code > 599 {
+		s.writeError(w, r, ErrInvalidParameter.WithMessage("status code must be a number between 100 and 599"))
+		return
+	}
+	if code == http.StatusSwitchingProtocols {
+		s.writeError(w, r, ErrInvalidParameter.WithMessage("status code 101 needs a protocol to switch to, use /ws"))
+		return
+	}
+
+	// 204 and 304 responses can't carry a body
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		w.WriteHeader(code)
+		return
+	}
+
+	s.writeResponse(w, r, code, ReflectedResponse{StatusCode: code})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestHandleStatus(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t))
+	tests := []struct {
+		path     string
+		status   int
+		hasBody  bool
+		rejected bool
+	}{
+		{path: "/status/101", rejected: true},
+		{path: "/status/200", status: 200, hasBody: true},
+		{path: "/status/204", status: 204},
+		{path: "/status/304", status: 304},
+		{path: "/status/418", status: 418, hasBody: true},
+		{path: "/status/503", status: 503, hasBody: true},
+		{path: "/status/599", status: 599, hasBody: true},
+		{path: "/status/600", rejected: true},
+		{path: "/status/99", rejected: true},
+		{path: "/status/abc", rejected: true},
+		{path: "/status/5x3", rejected: true},
+		{path: "/status/", rejected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := serve(handler, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if tt.rejected {
+				assertError(t, rec, http.StatusBadRequest, "invalid_parameter")
+				return
+			}
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if !tt.hasBody {
+				if rec.Body.Len() != 0 {
+					t.Errorf("body = %q, want none", rec.Body)
+				}
+				return
+			}
+			if got := decodeJSON(t, rec.Body)["status_code"]; got != float64(tt.status) {
+				t.Errorf("status_code = %v, want %d", got, tt.status)
+			}
+		})
+	}
+}
+
+// 1xx codes go out as an informational response ahead of the final 200,
+// with the handler timeout buffering the response or without it
+func TestHandleStatusInformational(t *testing.T) {
+	for _, args := range [][]string{nil, {"-handler-timeout", "0"}} {
+		ts := startTestServer(t, newTestServer(t, args...))
+		for _, code := range []int{100, 102, 103} {
+			var informational []int
+			trace := &httptrace.ClientTrace{
+				Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+					informational = append(informational, code)
+					return nil
+				},
+			}
+			ctx := httptrace.WithClientTrace(context.Background(), trace)
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/status/"+strconv.Itoa(code), nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("GET /status/%d: %v", code, err)
+			}
+			body := decodeJSON(t, resp.Body)
+			resp.Body.Close()
+			if want := []int{code}; !slices.Equal(informational, want) {
+				t.Errorf("%q: GET /status/%d informational responses = %v, want %v", args, code, informational, want)
+			}
+			if resp.StatusCode != http.StatusOK || body["status_code"] != float64(code) {
+				t.Errorf("%q: GET /status/%d = %d %v, want 200 with status_code %d", args, code, resp.StatusCode, body, code)
+			}
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// maxStreamCount caps ?count= so a single request can't stream forever
+const maxStreamCount = 1000
+
+// handleStream writes ?count= JSON lines, ?interval= apart, flushing each one
+// so clients can be tested against incremental delivery, e.g.
+// /stream?count=10&interval=200ms
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, r, ErrBadRequest.WithMessage("streaming is not supported on this connection"))
+		return
+	}
+
+	count := 10
+	if value := r.URL.Query().Get("count"); value != "" {
+		var err error
+		count, err = strconv.Atoi(value)
+		if err != nil || count < 1 || count > maxStreamCount {
+			s.writeError(w, r, ErrInvalidParameter.WithMessage("count must be a number between 1 and "+strconv.Itoa(maxStreamCount)))
+			return
+		}
+	}
+	interval := time.Second
+	if value := r.URL.Query().Get("interval"); value != "" {
+		var err error
+		interval, err = time.ParseDuration(value)
+		if err != nil || interval < 0 || interval > s.cfg.MaxDelay {
+			s.writeError(w, r, ErrInvalidParameter.WithMessage("interval must be a non-negative duration no longer than "+s.cfg.MaxDelay.String()))
+			return
+		}
+	}
+
+	deadline := s.newStreamDeadline(w, r)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	// The body would be thrown away, don't keep the client waiting for it
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	ticker := time.NewTicker(max(interval, time.Nanosecond))
+	defer ticker.Stop()
+	for seq := 1; seq <= count; seq++ {
+		if seq > 1 {
+			select {
+			case <-ticker.C:
+			case <-r.Context().Done():
+				// The client went away, stop producing lines
+				return
+			case <-s.shuttingDown:
+				return
+			}
+		}
+		line := map[string]interface{}{
+			"seq":  seq,
+			"time": time.Now().UTC().Format(time.RFC3339Nano),
+		}
+		deadline.extend()
+		if err := encoder.Encode(line); err != nil {
+			s.logStreamAborted(r, err, zap.Int("seq", seq))
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// streamDeadline bounds each write of a streaming response instead of the
+// whole response. The stream may well outlast the write timeout meant for
+// ordinary responses, but a consumer that stops reading is still dropped
+// once a write makes no progress for -stream-write-timeout.
+type streamDeadline struct {
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+// newStreamDeadline replaces the server's write timeout for the response
+// with a deadline of -stream-write-timeout from now, or none at all when
+// that is 0
+func (s *Server) newStreamDeadline(w http.ResponseWriter, r *http.Request) *streamDeadline {
+	d := &streamDeadline{rc: http.NewResponseController(w), timeout: s.cfg.StreamWriteTimeout}
+	if err := d.extend(); err != nil {
+		s.requestLogger(r).Debug("could not set the write deadline", zap.Error(err))
+	}
+	return d
+}
+
+// extend gives the next write another full timeout, streaming handlers call
+// it before every write
+func (d *streamDeadline) extend() error {
+	var deadline time.Time
+	if d.timeout > 0 {
+		deadline = time.Now().Add(d.timeout)
+	}
+	return d.rc.SetWriteDeadline(deadline)
+}
+
+// logStreamAborted logs why a streaming response ended early: usually the
+// client went away, or it stopped reading and the write deadline passed
+func (s *Server) logStreamAborted(r *http.Request, err error, fields ...zap.Field) {
+	fields = append(fields, zap.Error(err))
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		s.requestLogger(r).Info("slow consumer dropped, no write progress within the stream write timeout", fields...)
+		return
+	}
+	s.requestLogger(r).Debug("stream aborted", fields...)
+}
+
+// maxDelayStreamBytes caps ?bytes= of /delay-stream
+const maxDelayStreamBytes = 10 << 20
+
+// delayStreamTick is how often /delay-stream writes what it owes
+const delayStreamTick = 100 * time.Millisecond
+
+// handleDelayStream trickles ?bytes= bytes at ?rate= bytes per second, so the
+// body takes a predictable time to arrive, e.g. /delay-stream?bytes=1000&rate=100
+// takes 10 seconds. Handy for telling a client's read timeout apart from its
+// overall request timeout. The whole transfer may not take longer than
+// -max-delay, the response is cut short if a slow reader drags it past that.
+func (s *Server) handleDelayStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, r, ErrBadRequest.WithMessage("streaming is not supported on this connection"))
+		return
+	}
+
+	total := 1024
+	if value := r.URL.Query().Get("bytes"); value != "" {
+		var err error
+		total, err = strconv.Atoi(value)
+		if err != nil || total < 1 || total > maxDelayStreamBytes {
+			s.writeError(w, r, ErrInvalidParameter.WithMessage("bytes must be a number between 1 and "+strconv.Itoa(maxDelayStreamBytes)))
+			return
+		}
+	}
+	rate := 256
+	if value := r.URL.Query().Get("rate"); value != "" {
+		var err error
+		rate, err = strconv.Atoi(value)
+		if err != nil || rate < 1 {
+			s.writeError(w, r, ErrInvalidParameter.WithMessage("rate must be a positive number of bytes per second"))
+			return
+		}
+	}
+	duration := time.Duration(float64(total) / float64(rate) * float64(time.Second))
+	if duration > s.cfg.MaxDelay {
+		s.writeError(w, r, ErrInvalidParameter.WithMessage("bytes at this rate would take "+duration.String()+", longer than "+s.cfg.MaxDelay.String()))
+		return
+	}
+
+	writeDeadline := s.newStreamDeadline(w, r)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(total))
+	// no-transform keeps gzip from shrinking the body and with it the duration
+	w.Header().Set("Cache-Control", "no-cache, no-transform")
+	w.WriteHeader(http.StatusOK)
+	// The body would be thrown away, don't keep the client waiting for it
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	deadline := time.NewTimer(s.cfg.MaxDelay)
+	defer deadline.Stop()
+	ticker := time.NewTicker(delayStreamTick)
+	defer ticker.Stop()
+	chunk := bytes.Repeat([]byte{'.'}, min(rate, total))
+	start := time.Now()
+	written := 0
+	for written < total {
+		// Write whatever the elapsed time allows, which keeps the average
+		// rate exact however the ticks line up
+		due := min(int(time.Since(start).Seconds()*float64(rate)), total) - written
+		if written == 0 {
+			due = max(due, 1)
+		}
+		for due > 0 {
+			writeDeadline.extend()
+			n, err := w.Write(chunk[:min(due, len(chunk))])
+			written += n
+			due -= n
+			if err != nil {
+				s.logStreamAborted(r, err, zap.Int("written", written))
+				return
+			}
+		}
+		flusher.Flush()
+		if written == total {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			s.requestLogger(r).Info("delay stream cut off at the duration cap", zap.Int("written", written), zap.Int("bytes", total))
+			return
+		case <-r.Context().Done():
+			return
+		case <-s.shuttingDown:
+			return
+		}
+	}
+}
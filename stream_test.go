@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// startTestServer serves srv's full handler on a local listener, for tests
+// that need real connections, flushing included
+func startTestServer(t *testing.T, srv *Server) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(newTestHandler(t, srv))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestStream(t *testing.T) {
+	ts := startTestServer(t, newTestServer(t))
+
+	resp, err := http.Get(ts.URL + "/stream?count=3&interval=10ms")
+	if err != nil {
+		t.Fatalf("GET /stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want application/x-ndjson", got)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	seq := 0
+	for scanner.Scan() {
+		seq++
+		var line struct {
+			Seq  int    `json:"seq"`
+			Time string `json:"time"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("line %d %q: %v", seq, scanner.Text(), err)
+		}
+		if line.Seq != seq {
+			t.Errorf("line %d has seq %d", seq, line.Seq)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, line.Time); err != nil {
+			t.Errorf("line %d time %q: %v", seq, line.Time, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("reading the stream: %v", err)
+	}
+	if seq != 3 {
+		t.Errorf("got %d lines, want 3", seq)
+	}
+}
+
+// The lines arrive one by one rather than all at the end, and the handler
+// returns once the client goes away
+func TestStreamFlushesAndStopsOnCancel(t *testing.T) {
+	srv, logs := newObservedServer(t)
+	ts := startTestServer(t, srv)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/stream?count=1000&interval=20ms", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for i := 0; i < 2; i++ {
+		if !scanner.Scan() {
+			t.Fatalf("stream ended after %d lines: %v", i, scanner.Err())
+		}
+	}
+	cancel()
+	// The request is logged when the handler returns
+	for start := time.Now(); logs.FilterMessage("request received").Len() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("handler kept streaming after the client cancelled")
+		}
+	}
+}
+
+func TestStreamInvalidParams(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-max-delay", "1s"))
+	for _, query := range []string{"count=0", "count=1001", "count=many", "interval=-1s", "interval=2s", "interval=soon"} {
+		t.Run(query, func(t *testing.T) {
+			rec := serve(handler, httptest.NewRequest(http.MethodGet, "/stream?"+query, nil))
+			assertError(t, rec, http.StatusBadRequest, "invalid_parameter")
+		})
+	}
+}
+
+// plainWriter hides every optional interface of the ResponseWriter it
+// wraps, Flusher included
+type plainWriter struct {
+	w http.ResponseWriter
+}
+
+func (p plainWriter) Header() http.Header         { return p.w.Header() }
+func (p plainWriter) Write(b []byte) (int, error) { return p.w.Write(b) }
+func (p plainWriter) WriteHeader(status int)      { p.w.WriteHeader(status) }
+
+func TestStreamWithoutFlusher(t *testing.T) {
+	srv := newTestServer(t)
+	rec := httptest.NewRecorder()
+	srv.handleStream(plainWriter{rec}, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	assertError(t, rec, http.StatusBadRequest, "bad_request")
+}
+
+func TestDelayStream(t *testing.T) {
+	ts := startTestServer(t, newTestServer(t))
+
+	start := time.Now()
+	resp, err := http.Get(ts.URL + "/delay-stream?bytes=50&rate=100")
+	if err != nil {
+		t.Fatalf("GET /delay-stream: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("reading the body: %v", err)
+	}
+	if len(body) != 50 || resp.ContentLength != 50 {
+		t.Errorf("got %d bytes with Content-Length %d, want 50", len(body), resp.ContentLength)
+	}
+	// 50 bytes at 100 a second take half a second
+	if elapsed < 400*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("transfer took %v, want about 500ms", elapsed)
+	}
+}
+
+func TestDelayStreamInvalidParams(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-max-delay", "1s"))
+	for _, query := range []string{"bytes=0", "bytes=lots", "rate=0", "rate=-5", "bytes=1000&rate=10"} {
+		t.Run(query, func(t *testing.T) {
+			rec := serve(handler, httptest.NewRequest(http.MethodGet, "/delay-stream?"+query, nil))
+			assertError(t, rec, http.StatusBadRequest, "invalid_parameter")
+		})
+	}
+}
+
+// A client that stops reading makes the writes block until the stream write
+// deadline passes, much sooner than the server's write timeout
+func TestStreamDeadlineDropsSlowConsumer(t *testing.T) {
+	srv, logs := newObservedServer(t, "-stream-write-timeout", "100ms")
+	failed := make(chan error, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline := srv.newStreamDeadline(w, r)
+		chunk := make([]byte, 64<<10)
+		for {
+			deadline.extend()
+			if _, err := w.Write(chunk); err != nil {
+				srv.logStreamAborted(r, err)
+				failed <- err
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Send the request and never read the answer
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-failed:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("write error = %v, want the deadline", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the write to a stuck consumer never failed")
+	}
+	if logs.FilterMessageSnippet("slow consumer dropped").Len() != 1 {
+		t.Error("the dropped consumer wasn't logged")
+	}
+}
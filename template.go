@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"text/template"
+)
+
+// maxResponseTemplateBytes caps the length of -response-template
+const maxResponseTemplateBytes = 64 << 10
+
+// maxTemplateOutputBytes caps what a response template may render, a range
+// over a large number would otherwise fill the memory
+const maxTemplateOutputBytes = 1 << 20
+
+// errTemplateOutputTooLarge ends a template rendering more than
+// maxTemplateOutputBytes
+var errTemplateOutputTooLarge = fmt.Errorf("output exceeds %d bytes", maxTemplateOutputBytes)
+
+// templateFuncs are the functions response templates can call besides the
+// text/template builtins
+var templateFuncs = template.FuncMap{
+	// json encodes a value, e.g. {"name": {{json .Body.name}}} quotes and
+	// escapes the string
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// templateData is what a response template is executed with
+type templateData struct {
+	Method  string
+	Path    string
+	Query   url.Values
+	Headers http.Header
+	// Body is the parsed request body: maps, slices, strings, json.Number
+	// and so on for JSON, url.Values for forms and a string otherwise
+	Body interface{}
+	// RawBody is the body as it was sent
+	RawBody string
+}
+
+// parseResponseTemplate parses -response-template. Fields missing from the
+// body are an error when the template runs, rather than "<no value>" in
+// the response.
+func parseResponseTemplate(text string) (*template.Template, error) {
+	if len(text) > maxResponseTemplateBytes {
+		return nil, fmt.Errorf("response template must be at most %d bytes, got %d", maxResponseTemplateBytes, len(text))
+	}
+	tmpl, err := template.New("response").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// writeTemplateResponse renders -response-template for the request and sends
+// the result, labeled as JSON when it is valid JSON and as plain text
+// otherwise. The template renders into a buffer first, a failing one gets a
+// 500 that says why.
+func (s *Server) writeTemplateResponse(w http.ResponseWriter, r *http.Request, body []byte, bodyData interface{}) {
+	data := templateData{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Query:   r.URL.Query(),
+		Headers: r.Header,
+		Body:    bodyData,
+		RawBody: string(body),
+	}
+	var buf bytes.Buffer
+	if err := s.cfg.responseTemplate.Execute(&limitedWriter{w: &buf, remaining: maxTemplateOutputBytes}, data); err != nil {
+		s.requestLogger(r).Warn("response template failed", zap.Error(err))
+		s.writeError(w, r, ErrTemplateFailed.WithMessage("response template failed: "+templateErrorMessage(err)))
+		return
+	}
+
+	contentType := "text/plain; charset=utf-8"
+	if json.Valid(buf.Bytes()) {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// templateErrorMessage is err without the wrapping text/template adds to
+// errors of the writer
+func templateErrorMessage(err error) string {
+	if errors.Is(err, errTemplateOutputTooLarge) {
+		return errTemplateOutputTooLarge.Error()
+	}
+	return err.Error()
+}
+
+// limitedWriter fails writes once more than remaining bytes were written
+type limitedWriter struct {
+	w         *bytes.Buffer
+	remaining int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > l.remaining {
+		return 0, errTemplateOutputTooLarge
+	}
+	l.remaining -= len(p)
+	return l.w.Write(p)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseTemplate(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-response-template",
+		`{"hello": {{json .Body.name}}, "lang": {{json (index .Query "lang" 0)}}, "agent": {{json (.Headers.Get "X-Agent")}}, "method": "{{.Method}}"}`))
+	req := httptest.NewRequest(http.MethodPost, "/post?lang=en", strings.NewReader(`{"name": "ada <lovelace>"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Agent", "test")
+	rec := serve(handler, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200, body %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	response := decodeJSON(t, rec.Body)
+	for field, want := range map[string]string{"hello": "ada <lovelace>", "lang": "en", "agent": "test", "method": "POST"} {
+		if response[field] != want {
+			t.Errorf("%s = %v, want %q", field, response[field], want)
+		}
+	}
+}
+
+// Output that isn't JSON goes out as plain text
+func TestResponseTemplatePlainText(t *testing.T) {
+	handler := newTestHandler(t, newTestServer(t, "-response-template", `hello {{.Body.name}}`))
+	req := httptest.NewRequest(http.MethodPut, "/put", strings.NewReader(`{"name": "ada"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := serve(handler, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello ada" {
+		t.Fatalf("PUT /put = %d %q, want 200 \"hello ada\"", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want text/plain", got)
+	}
+}
+
+func TestResponseTemplateFailed(t *testing.T) {
+	tests := []struct {
+		name, template, message string
+	}{
+		{"missing field", `{{.Body.missing}}`, `map has no entry for key "missing"`},
+		// 1000 times 1000 items of 2 bytes, past the 1 MiB cap
+		{"output too large", `{{range .Body.items}}{{range $.Body.items}}xx{{end}}{{end}}`, errTemplateOutputTooLarge.Error()},
+	}
+	body := `{"name": "ada", "items": [0` + strings.Repeat(", 0", 999) + `]}`
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := serve(newTestHandler(t, newTestServer(t, "-response-template", tt.template)), req)
+			if rec.Code != http.StatusInternalServerError {
+				t.Fatalf("status = %d, want 500, body %s", rec.Code, rec.Body)
+			}
+			apiErr := decodeJSON(t, rec.Body)["error"].(map[string]interface{})
+			if message, _ := apiErr["message"].(string); apiErr["code"] != "template_failed" || !strings.Contains(message, tt.message) {
+				t.Errorf("error = %v, want template_failed saying %q", apiErr, tt.message)
+			}
+		})
+	}
+}
+
+func TestParseResponseTemplateInvalid(t *testing.T) {
+	for name, text := range map[string]string{
+		"unclosed action": `{{.Body.name`,
+		"too long":        strings.Repeat("x", maxResponseTemplateBytes+1),
+	} {
+		if _, err := parseResponseTemplate(text); err == nil {
+			t.Errorf("%s: the template was accepted", name)
+		}
+	}
+}
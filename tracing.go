@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"os"
+)
+
+// tracingEnabled reports whether an OTLP endpoint is configured. Without one
+// no spans are recorded and the tracing middleware isn't installed at all.
+func tracingEnabled() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// initTracing installs a tracer provider exporting spans over OTLP/HTTP. The
+// exporter takes its endpoint, headers and so on from the standard OTEL_*
+// environment variables. The returned function flushes pending spans.
+func initTracing(ctx context.Context) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName("go-simple-server")))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	// Continue traces started upstream through the traceparent header
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// tracingMiddleware starts a span per request, named after the mux pattern
+// rather than the raw path for the same reason the metrics are. It must run
+// inside requestIDMiddleware so the span can carry the request ID.
+func tracingMiddleware(mux *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		annotate := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, pattern := mux.Handler(r)
+			trace.SpanFromContext(r.Context()).SetAttributes(
+				semconv.HTTPRoute(pattern),
+				attribute.String("request.id", requestID(r)),
+			)
+			next.ServeHTTP(w, r)
+		})
+
+		return otelhttp.NewHandler(annotate, "http.server",
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				_, pattern := mux.Handler(r)
+				return r.Method + " " + pattern
+			}),
+		)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// recordSpans installs a tracer provider keeping finished spans in memory,
+// restoring the global one when the test ends
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+	return recorder
+}
+
+func TestTracing(t *testing.T) {
+	recorder := recordSpans(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler, _ := newTestServer(t).newHandler(ctx, func() {}, true)
+
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req := httptest.NewRequest(http.MethodGet, "/status/418", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	req.Header.Set("X-Request-ID", "trace-me")
+	serve(handler, req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if got := span.Name(); got != "GET /status/" {
+		t.Errorf("span name = %q, want GET /status/", got)
+	}
+	if got := span.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("trace ID = %s, want the upstream %s", got, traceID)
+	}
+	if got := span.Parent().SpanID().String(); got != parentID || !span.Parent().IsRemote() {
+		t.Errorf("parent = %s, want the remote %s", got, parentID)
+	}
+
+	attrs := make(map[string]string)
+	for _, kv := range span.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	for key, want := range map[string]string{
+		"http.method":      http.MethodGet,
+		"http.route":       "/status/",
+		"http.status_code": "418",
+		"request.id":       "trace-me",
+	} {
+		if attrs[key] != want {
+			t.Errorf("attribute %s = %q, want %q", key, attrs[key], want)
+		}
+	}
+}
+
+// Without an exporter the middleware isn't installed, so nothing is recorded
+func TestTracingDisabled(t *testing.T) {
+	recorder := recordSpans(t)
+	serve(newTestHandler(t, newTestServer(t)), httptest.NewRequest(http.MethodGet, "/get", nil))
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Errorf("recorded %d spans with tracing off", len(spans))
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// unixAddrPrefix marks a listen address as the path of a Unix domain socket
+const unixAddrPrefix = "unix:"
+
+// unixSocketMode lets the owner and group connect, e.g. a sidecar running as
+// another user of the same group
+const unixSocketMode = 0o660
+
+// unixSocketPath returns the socket path of a unix:/path address
+func unixSocketPath(addr string) (string, bool) {
+	path, ok := strings.CutPrefix(addr, unixAddrPrefix)
+	return path, ok
+}
+
+// listen binds addr, a host:port pair or a unix:/path socket
+func listen(addr string) (net.Listener, error) {
+	path, ok := unixSocketPath(addr)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	return listenUnix(path)
+}
+
+// listenUnix listens on the socket at path. A socket left behind by a server
+// that didn't shut down cleanly is replaced, one another server still accepts
+// on is not, and neither is any other kind of file. The listener removes
+// the socket file again when it is closed.
+func listenUnix(path string) (net.Listener, error) {
+	info, err := os.Lstat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	case info.Mode().Type() != fs.ModeSocket:
+		return nil, fmt.Errorf("%s exists and is not a socket", path)
+	default:
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another server", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, unixSocketMode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.sock")
+	listener, err := listen(unixAddrPrefix + path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &http.Server{Handler: newTestHandler(t, newTestServer(t))}
+	go server.Serve(listener)
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != unixSocketMode {
+		t.Errorf("socket file = %v, %v, want mode %o", info, err, unixSocketMode)
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://unix/get")
+	if err != nil {
+		t.Fatalf("GET /get over the socket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+
+	// A socket that is still accepted on isn't taken over
+	if l, err := listen(unixAddrPrefix + path); err == nil {
+		l.Close()
+		t.Error("listened on a socket another server is using")
+	}
+
+	server.Close()
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("socket file after shutdown: %v, want it removed", err)
+	}
+}
+
+func TestUnixSocketStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.sock")
+	// A server that died leaves its socket file behind
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := listen(unixAddrPrefix + path)
+	if err != nil {
+		t.Fatalf("listen over a stale socket: %v", err)
+	}
+	listener.Close()
+}
+
+func TestUnixSocketNotASocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.sock")
+	if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if listener, err := listen(unixAddrPrefix + path); err == nil {
+		listener.Close()
+		t.Fatal("replaced a regular file with a socket")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "data" {
+		t.Error("the regular file was touched")
+	}
+}
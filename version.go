@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+)
+
+// Build information, set at build time with
+//
+//	go build -ldflags "-X main.version=1.2.3 -X main.commit=$(git rev-parse --short HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version = "dev"
+	commit  = "dev"
+	date    = "dev"
+)
+
+// handleVersion reports which build is running
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"version":     version,
+		"commit":      commit,
+		"date":        date,
+		"go_version":  runtime.Version(),
+		"status_code": http.StatusOK,
+	}
+	s.writeResponse(w, r, http.StatusOK, response)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/xml"
+	"net/http"
+)
+
+// WhoamiResponse is how the server sees the client: its address before and
+// after resolving forwarding headers, the TLS connection and the identity its
+// credentials resolve to
+type WhoamiResponse struct {
+	XMLName      xml.Name   `json:"-" xml:"response"`
+	IP           string     `json:"ip" xml:"ip"`
+	RemoteAddr   string     `json:"remote_addr" xml:"remote_addr"`
+	ForwardedFor string     `json:"forwarded_for,omitempty" xml:"forwarded_for,omitempty"`
+	TLS          *WhoamiTLS `json:"tls" xml:"tls"`
+	Auth         WhoamiAuth `json:"auth" xml:"auth"`
+	StatusCode   int        `json:"status_code" xml:"status_code"`
+}
+
+// WhoamiTLS describes the TLS connection, it is nil over plain HTTP
+type WhoamiTLS struct {
+	Version     string `json:"version" xml:"version"`
+	CipherSuite string `json:"cipher_suite" xml:"cipher_suite"`
+	ServerName  string `json:"server_name" xml:"server_name"`
+	ALPN        string `json:"alpn" xml:"alpn"`
+	Resumed     bool   `json:"resumed" xml:"resumed"`
+}
+
+// WhoamiAuth is the identity the request's credentials resolve to. /whoami
+// doesn't require credentials, without valid ones it reports none.
+type WhoamiAuth struct {
+	Authenticated bool   `json:"authenticated" xml:"authenticated"`
+	Method        string `json:"method,omitempty" xml:"method,omitempty"`
+	User          string `json:"user,omitempty" xml:"user,omitempty"`
+}
+
+// handleWhoami reports the client's resolved identity, for debugging proxy
+// and TLS termination setups
+func (s *Server) handleWhoami(w http.ResponseWriter, r *http.Request) {
+	response := WhoamiResponse{
+		IP:           s.clientIP(r),
+		RemoteAddr:   r.RemoteAddr,
+		ForwardedFor: r.Header.Get("X-Forwarded-For"),
+		Auth:         s.whoamiAuth(r),
+		StatusCode:   http.StatusOK,
+	}
+	if r.TLS != nil {
+		response.TLS = &WhoamiTLS{
+			Version:     tls.VersionName(r.TLS.Version),
+			CipherSuite: tls.CipherSuiteName(r.TLS.CipherSuite),
+			ServerName:  r.TLS.ServerName,
+			ALPN:        r.TLS.NegotiatedProtocol,
+			Resumed:     r.TLS.DidResume,
+		}
+	}
+	s.writeResponse(w, r, http.StatusOK, response)
+}
+
+// whoamiAuth checks the request's credentials like the auth middleware does,
+// basic auth first and then the API key
+func (s *Server) whoamiAuth(r *http.Request) WhoamiAuth {
+	if s.cfg.BasicAuthUsername != "" || s.cfg.BasicAuthPassword != "" {
+		if user, ok := basicAuthUser(r, s.cfg.BasicAuthUsername, s.cfg.BasicAuthPassword); ok {
+			return WhoamiAuth{Authenticated: true, Method: "basic", User: user}
+		}
+	}
+	if len(s.cfg.APIKeys) > 0 {
+		if keyID, ok := apiKeyUser(r, s.cfg.APIKeys); ok {
+			return WhoamiAuth{Authenticated: true, Method: "api_key", User: keyID}
+		}
+	}
+	return WhoamiAuth{}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWhoami(t *testing.T) {
+	t.Setenv("BASIC_AUTH_USERNAME", "admin")
+	t.Setenv("BASIC_AUTH_PASSWORD", "secret")
+	// httptest requests come from 192.0.2.1
+	handler := newTestHandler(t, newTestServer(t, "-trusted-proxies", "192.0.2.0/24"))
+
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	rec := serve(handler, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	body := decodeJSON(t, rec.Body)
+	if body["ip"] != "203.0.113.7" || body["remote_addr"] != req.RemoteAddr || body["forwarded_for"] != "203.0.113.7" {
+		t.Errorf("addresses = %v %v %v, want the forwarded client behind %s", body["ip"], body["remote_addr"], body["forwarded_for"], req.RemoteAddr)
+	}
+	if body["tls"] != nil {
+		t.Errorf("tls = %v over plain HTTP, want null", body["tls"])
+	}
+	if auth := body["auth"].(map[string]interface{}); auth["authenticated"] != false {
+		t.Errorf("auth = %v without credentials, want none", auth)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	req.SetBasicAuth("admin", "secret")
+	auth := decodeJSON(t, serve(handler, req).Body)["auth"].(map[string]interface{})
+	if auth["authenticated"] != true || auth["method"] != "basic" || auth["user"] != "admin" {
+		t.Errorf("auth = %v, want the basic auth user", auth)
+	}
+}
+
+func TestWhoamiTLS(t *testing.T) {
+	ts := httptest.NewUnstartedServer(newTestHandler(t, newTestServer(t)))
+	ts.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	ts.StartTLS()
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/whoami")
+	if err != nil {
+		t.Fatalf("GET /whoami: %v", err)
+	}
+	defer resp.Body.Close()
+	state, _ := decodeJSON(t, resp.Body)["tls"].(map[string]interface{})
+	if state["version"] != "TLS 1.2" || state["cipher_suite"] != tls.CipherSuiteName(resp.TLS.CipherSuite) {
+		t.Errorf("tls = %v, want TLS 1.2 with %s", state, tls.CipherSuiteName(resp.TLS.CipherSuite))
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// wsControlTimeout bounds writing a ping or close frame, and how long the
+// client gets to answer the close frame sent on shutdown
+const wsControlTimeout = time.Second
+
+// handleWebSocket upgrades the connection and echoes every text and binary
+// message back with the same type. Browsers on any origin may connect, /ws
+// holds nothing that needs protecting.
+//
+// The connection is hijacked, so -write-timeout and -read-timeout don't
+// apply: each echo gets -stream-write-timeout, and with -ws-ping-interval
+// set a client that answers neither pings nor sends anything is dropped.
+func (s *Server) handleWebSocket() http.HandlerFunc {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(*http.Request) bool { return true },
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			s.requestLogger(r).Debug("websocket upgrade failed", zap.Error(reason))
+			s.writeError(w, r, errorForStatus(status))
+		},
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader has already answered
+			return
+		}
+		s.background.Add(1)
+		defer s.background.Done()
+		defer conn.Close()
+
+		logger := s.requestLogger(r)
+		start := time.Now()
+		logger.Info("websocket opened", zap.String("ip", s.clientIP(r)))
+
+		conn.SetReadLimit(s.cfg.WSMaxMessageBytes)
+		extendRead := func() {
+			deadline := time.Time{}
+			if s.cfg.WSPingInterval > 0 {
+				deadline = time.Now().Add(2 * s.cfg.WSPingInterval)
+			}
+			conn.SetReadDeadline(deadline)
+		}
+		extendRead()
+		conn.SetPongHandler(func(string) error {
+			extendRead()
+			return nil
+		})
+		conn.SetCloseHandler(func(code int, _ string) error {
+			err := conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(wsControlTimeout))
+			// On shutdown this answers the server's own close frame
+			if errors.Is(err, websocket.ErrCloseSent) {
+				return nil
+			}
+			return err
+		})
+
+		done := make(chan struct{})
+		defer close(done)
+		go s.superviseWebSocket(conn, done)
+
+		var messages, bytes int
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				fields := []zap.Field{zap.Int("messages", messages), zap.Int("bytes", bytes), zap.Duration("duration", time.Since(start))}
+				var closeErr *websocket.CloseError
+				if errors.As(err, &closeErr) {
+					fields = append(fields, zap.Int("close_code", closeErr.Code))
+				} else {
+					fields = append(fields, zap.Error(err))
+				}
+				logger.Info("websocket closed", fields...)
+				return
+			}
+			extendRead()
+			messages++
+			bytes += len(data)
+			logger.Debug("websocket message", zap.Int("type", messageType), zap.Int("size", len(data)))
+
+			deadline := time.Time{}
+			if s.cfg.StreamWriteTimeout > 0 {
+				deadline = time.Now().Add(s.cfg.StreamWriteTimeout)
+			}
+			conn.SetWriteDeadline(deadline)
+			if err := conn.WriteMessage(messageType, data); err != nil {
+				logger.Info("websocket closed, echo failed", zap.Int("messages", messages), zap.Int("bytes", bytes), zap.Duration("duration", time.Since(start)), zap.Error(err))
+				return
+			}
+		}
+	}
+}
+
+// superviseWebSocket pings the client every -ws-ping-interval and starts the
+// close handshake once the server shuts down, closing the connection itself
+// if the client doesn't answer in time. It returns when done is closed.
+func (s *Server) superviseWebSocket(conn *websocket.Conn, done <-chan struct{}) {
+	var ping <-chan time.Time
+	if s.cfg.WSPingInterval > 0 {
+		ticker := time.NewTicker(s.cfg.WSPingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ping:
+			// A failed ping leaves the client to the read deadline
+			conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsControlTimeout))
+		case <-s.shuttingDown:
+			message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+			conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(wsControlTimeout))
+			select {
+			case <-done:
+			case <-time.After(wsControlTimeout):
+				conn.Close()
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gorilla/websocket"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialWS opens a WebSocket to /ws of srv
+func dialWS(t *testing.T, srv *Server) *websocket.Conn {
+	t.Helper()
+	ts := startTestServer(t, srv)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dialing /ws: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	srv, logs := newObservedServer(t)
+	conn := dialWS(t, srv)
+
+	for _, sent := range []struct {
+		messageType int
+		data        []byte
+	}{
+		{websocket.TextMessage, []byte("hello")},
+		{websocket.BinaryMessage, []byte{0, 1, 2}},
+	} {
+		if err := conn.WriteMessage(sent.messageType, sent.data); err != nil {
+			t.Fatalf("sending: %v", err)
+		}
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("reading the echo: %v", err)
+		}
+		if messageType != sent.messageType || !bytes.Equal(data, sent.data) {
+			t.Errorf("echo = %d %q, want %d %q", messageType, data, sent.messageType, sent.data)
+		}
+	}
+
+	// The default close handler would try to answer the server's reply
+	conn.SetCloseHandler(func(int, string) error { return nil })
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("after closing read = %v, want the close answered", err)
+	}
+	for start := time.Now(); logs.FilterMessage("websocket closed").Len() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the closed connection wasn't logged")
+		}
+	}
+	closed := logs.FilterMessage("websocket closed").All()[0].ContextMap()
+	if closed["messages"] != int64(2) || closed["bytes"] != int64(8) {
+		t.Errorf("websocket closed with %v messages and %v bytes, want 2 and 8", closed["messages"], closed["bytes"])
+	}
+}
+
+func TestWebSocketMessageTooBig(t *testing.T) {
+	conn := dialWS(t, newTestServer(t, "-ws-max-message-bytes", "4"))
+	conn.WriteMessage(websocket.TextMessage, []byte("far too long"))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("read = %v, want a close with 1009", err)
+	}
+}
+
+func TestWebSocketShutdown(t *testing.T) {
+	srv := newTestServer(t)
+	conn := dialWS(t, srv)
+	// An echo proves the handler is past the upgrade and watching
+	conn.WriteMessage(websocket.TextMessage, []byte("ping"))
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatalf("reading the echo: %v", err)
+	}
+
+	close(srv.shuttingDown)
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Errorf("read during shutdown = %v, want a close with 1001", err)
+	}
+}